@@ -0,0 +1,359 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// archiveWriter adds files to an archive.
+type archiveWriter interface {
+	// Create adds a new member `name` with the metadata of `info` to the
+	// archive and returns a writer for its content.
+	Create(name string, info fs.FileInfo) (io.Writer, error)
+	// CopyFrom copies all members of the archive `filename` in the same format
+	// and returns their names.
+	CopyFrom(filename string) ([]string, error)
+	Close() error
+}
+
+type zipArchiveWriter struct {
+	writer *zip.Writer
+}
+
+func (w *zipArchiveWriter) Create(name string, info fs.FileInfo) (io.Writer, error) {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return nil, err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+	return w.writer.CreateHeader(header)
+}
+
+func (w *zipArchiveWriter) CopyFrom(filename string) ([]string, error) {
+	reader, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	var names []string = []string{}
+	for _, member := range reader.File {
+		err = w.writer.Copy(member)
+		if err != nil {
+			return names, err
+		}
+		names = append(names, member.Name)
+	}
+	return names, nil
+}
+
+func (w *zipArchiveWriter) Close() error {
+	return w.writer.Close()
+}
+
+type tarArchiveWriter struct {
+	writer     *tar.Writer
+	compressor *gzip.Writer
+}
+
+func (w *tarArchiveWriter) Create(name string, info fs.FileInfo) (io.Writer, error) {
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return nil, err
+	}
+	header.Name = name
+	header.Uname, header.Gname = "", ""
+	err = w.writer.WriteHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	return w.writer, nil
+}
+
+func (w *tarArchiveWriter) CopyFrom(filename string) ([]string, error) {
+	var names []string = []string{}
+	err := walkTarArchive(filename, w.compressor != nil, func(header *tar.Header, content io.Reader) error {
+		err := w.writer.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w.writer, content)
+		names = append(names, header.Name)
+		return err
+	})
+	return names, err
+}
+
+func (w *tarArchiveWriter) Close() error {
+	err := w.writer.Close()
+	if w.compressor != nil {
+		err = errors.Join(err, w.compressor.Close())
+	}
+	return err
+}
+
+// newArchiveWriter returns an archiveWriter writing an archive of format
+// `format` into `w`.
+func newArchiveWriter(w io.Writer, format DestinationFormat) (archiveWriter, error) {
+	switch format {
+	case ZIP:
+		return &zipArchiveWriter{writer: zip.NewWriter(w)}, nil
+	case TAR:
+		return &tarArchiveWriter{writer: tar.NewWriter(w)}, nil
+	case TARGZ:
+		compressor := gzip.NewWriter(w)
+		return &tarArchiveWriter{writer: tar.NewWriter(compressor), compressor: compressor}, nil
+	}
+	return nil, fmt.Errorf("%s is not an archive format", format.String())
+}
+
+// walkTarArchive calls `fn` for every member of the (gzip compressed if
+// `compressed` is true) tar archive `filename`.
+func walkTarArchive(filename string, compressed bool, fn func(*tar.Header, io.Reader) error) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var reader io.Reader = file
+	if compressed {
+		decompressor, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer decompressor.Close()
+		reader = decompressor
+	}
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = fn(header, tarReader)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// archiveMemberMd5sums returns the md5 sums of the regular members of the
+// archive `filename` keyed by member name.
+func archiveMemberMd5sums(filename string, format DestinationFormat) (map[string]string, error) {
+	var md5sums map[string]string = map[string]string{}
+	if format == ZIP {
+		reader, err := zip.OpenReader(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		for _, member := range reader.File {
+			if !member.Mode().IsRegular() {
+				continue
+			}
+			content, err := member.Open()
+			if err != nil {
+				return nil, err
+			}
+			md5sums[member.Name], err = md5sumReader(content)
+			content.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return md5sums, nil
+	}
+	err := walkTarArchive(filename, format == TARGZ, func(header *tar.Header, content io.Reader) error {
+		if header.Typeflag != tar.TypeReg {
+			return nil
+		}
+		md5sum, err := md5sumReader(content)
+		md5sums[header.Name] = md5sum
+		return err
+	})
+	return md5sums, err
+}
+
+// addFileToArchive adds the file `src` as member `name` to the archive.
+func addFileToArchive(writer archiveWriter, src, name string) error {
+	source, info, err := openSourceFile(sourceOf(src))
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	member, err := writer.Create(name, info)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(member, source)
+	return err
+}
+
+// writeArchive writes the picked files into an archive at the destination
+// path. The archive is written to a temporary file first and only moved into
+// place once complete, so that a failed run leaves an existing archive
+// untouched. With the append destination option the members of an existing
+// archive are carried over. If `options.Verify` is set then the archive is
+// written again if a member does not match its source, at most
+// `options.VerifyRetries` times; files that still do not match are left out of
+// the archive and reported in a VerificationError. The paths of the picked
+// files in the archive are returned keyed by their source path.
+func writeArchive(options ProgramOptions, pickedFiles Files) (map[string]string, error) {
+	var destination string = path.Clean(options.Destination)
+	if options.DestinationOption == ROTATE || options.DestinationOption == SYNC {
+		return nil, fmt.Errorf("destination option %s is not supported with destination format %s",
+			options.DestinationOption.String(), options.DestinationFormat.String())
+	}
+	var exists bool = false
+	if _, err := os.Stat(destination); err == nil {
+		exists = true
+		switch options.DestinationOption {
+		case APPEND:
+			log.Debug().Msgf("appending files to existing archive %s", destination)
+		case DELETE, TRASH, ATOMIC:
+			log.Info().Msgf("replacing existing archive %s", destination)
+		default:
+			return nil, errors.New("destination archive already exists, aborting")
+		}
+	}
+	err := os.MkdirAll(path.Dir(destination), os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("error creating destination folder %s: %w", path.Dir(destination), err)
+	}
+
+	var temporary string = destination + ".tmp"
+	defer os.Remove(temporary)
+	var included Files = pickedFiles
+	var failed Files = Files{}
+	var names []string
+	for attempt := 0; ; attempt++ {
+		names, err = writeArchiveFile(temporary, options, included, exists && options.DestinationOption == APPEND)
+		if err != nil {
+			return nil, err
+		}
+		if !options.Verify {
+			break
+		}
+		mismatched, err := mismatchedArchiveMembers(temporary, options.DestinationFormat, included, names)
+		if err != nil {
+			return nil, fmt.Errorf("cannot verify archive %s: %w", temporary, err)
+		}
+		if len(mismatched) == 0 {
+			log.Debug().Msgf("verified archive %s", temporary)
+			break
+		}
+		if attempt < options.VerifyRetries {
+			log.Warn().Msgf("verification of %d file(s) in archive %s failed, writing it again", len(mismatched), temporary)
+			continue
+		}
+		for _, file := range mismatched {
+			log.Error().Msgf("giving up on adding %s to archive %s after %d attempt(s)", file.Path, destination, attempt+1)
+		}
+		failed = append(failed, mismatched...)
+		included = withoutFiles(included, mismatched)
+	}
+
+	if exists && options.DestinationOption == TRASH {
+		err = moveToTrash(destination, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("cannot move %s to the trash: %w", destination, err)
+		}
+	}
+	err = os.Rename(temporary, destination)
+	if err != nil {
+		return nil, fmt.Errorf("cannot move %s to %s: %w", temporary, destination, err)
+	}
+	log.Info().Msgf("wrote %d file(s) into archive %s", len(included), destination)
+	var placed map[string]string = map[string]string{}
+	for i, file := range included {
+		placed[file.Path] = archiveMemberPath(destination, names[i])
+	}
+	if len(failed) > 0 {
+		return placed, &VerificationError{Files: failed}
+	}
+	return placed, nil
+}
+
+// writeArchiveFile writes the archive file `filename` holding the picked files
+// and returns their member names.
+func writeArchiveFile(filename string, options ProgramOptions, pickedFiles Files, appendExisting bool) ([]string, error) {
+	out, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	names, err := writeArchiveMembers(out, options, pickedFiles, appendExisting)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return names, err
+}
+
+// mismatchedArchiveMembers returns the picked files whose members `names` in
+// the archive `filename` do not match the md5 sum of the file.
+func mismatchedArchiveMembers(filename string, format DestinationFormat, pickedFiles Files, names []string) (Files, error) {
+	md5sums, err := archiveMemberMd5sums(filename, format)
+	if err != nil {
+		return nil, err
+	}
+	var mismatched Files = Files{}
+	for i, file := range pickedFiles {
+		if md5sum, ok := md5sums[names[i]]; !ok || md5sum != file.Md5sum {
+			log.Warn().Msgf("verification of %s in archive %s failed: md5 sum %s does not match %s", names[i], filename, md5sum, file.Md5sum)
+			mismatched = append(mismatched, file)
+		}
+	}
+	return mismatched, nil
+}
+
+// writeArchiveMembers writes the picked files as archive members into `out`,
+// optionally carrying over the members of the existing archive first, and
+// returns the member names of the picked files.
+func writeArchiveMembers(out io.Writer, options ProgramOptions, pickedFiles Files, appendExisting bool) ([]string, error) {
+	writer, err := newArchiveWriter(out, options.DestinationFormat)
+	if err != nil {
+		return nil, err
+	}
+	var taken map[string]bool = map[string]bool{}
+	if appendExisting {
+		existingNames, err := writer.CopyFrom(options.Destination)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read existing archive %s: %s", options.Destination, err.Error())
+		}
+		for _, name := range existingNames {
+			taken[name] = true
+		}
+	}
+	names, err := assignDestinationNames(pickedFiles, func(name string) bool {
+		return taken[name]
+	}, renameOnCollision(options))
+	if err != nil {
+		return nil, err
+	}
+	for i, file := range pickedFiles {
+		log.Debug().Msgf("adding %s to archive as %s", file.Path, names[i])
+		err = addFileToArchive(writer, file.Path, names[i])
+		if err != nil {
+			return nil, fmt.Errorf("error adding %s to archive (%s)", file.Path, err.Error())
+		}
+	}
+	return names, writer.Close()
+}
+
+// archiveMemberPath returns the path of member `name` in the archive
+// `archive`.
+func archiveMemberPath(archive, name string) string {
+	return archive + "!" + name
+}
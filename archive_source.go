@@ -0,0 +1,174 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// errArchiveMemberFound stops walking a tar archive once the wanted member
+// has been read.
+var errArchiveMemberFound = errors.New("archive member found")
+
+// archiveFormat returns the archive format of the file `filename` based on
+// its extension and whether it is an archive at all.
+func archiveFormat(filename string) (DestinationFormat, bool) {
+	switch {
+	case strings.HasSuffix(filename, ".zip"):
+		return ZIP, true
+	case strings.HasSuffix(filename, ".tar"):
+		return TAR, true
+	case strings.HasSuffix(filename, ".tar.gz"), strings.HasSuffix(filename, ".tgz"):
+		return TARGZ, true
+	}
+	return DIRECTORY, false
+}
+
+// splitArchiveMemberPath splits a path of the form `archive!member` into the
+// path of the archive and the name of the member. The archive part has to
+// name an existing archive for the path to be split.
+func splitArchiveMemberPath(filename string) (string, string, bool) {
+	for i := 0; i < len(filename); i++ {
+		if filename[i] != '!' {
+			continue
+		}
+		var archive string = filename[:i]
+		if _, ok := archiveFormat(archive); !ok {
+			continue
+		}
+		if info, err := os.Stat(archive); err == nil && info.Mode().IsRegular() {
+			return archive, filename[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// getFilesFromArchive returns the regular members of the archive `filename`
+// as Files with paths of the form `archive!member`.
+func getFilesFromArchive(filename string) (Files, error) {
+	format, ok := archiveFormat(filename)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a zip or tar archive", filename)
+	}
+	log.Debug().Msgf("reading archive %s", filename)
+	md5sums, err := archiveMemberMd5sums(filename, format)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read archive %s: %s", filename, err.Error())
+	}
+	var members []string = []string{}
+	for member := range md5sums {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	var files Files = Files{}
+	for _, member := range members {
+		files = append(files, File{
+			Name:     path.Base(member),
+			Path:     archiveMemberPath(filename, member),
+			Md5sum:   md5sums[member],
+			LastSeen: time.Now().UTC(),
+		})
+	}
+	log.Debug().Msgf("found %d files in archive %s", len(files), filename)
+	return files, nil
+}
+
+// archiveSource is a Source backed by the members of a zip or tar archive.
+// It only supports opening the members; the archive is scanned with
+// getFilesFromArchive. Member names are used as stored in the archive, even if
+// they are not valid fs.FS names.
+type archiveSource struct {
+	archive string
+}
+
+// newArchiveSource returns a Source for the members of the archive `archive`.
+func newArchiveSource(archive string) *archiveSource {
+	return &archiveSource{archive: archive}
+}
+
+func (s *archiveSource) Open(name string) (fs.File, error) {
+	return openArchiveMember(s.archive, name)
+}
+
+func (s *archiveSource) Path(name string) string {
+	return archiveMemberPath(s.archive, name)
+}
+
+// openArchiveMember opens the member `member` of the archive `archive` for
+// reading. Members of tar archives are read into memory since tar archives
+// can only be read sequentially.
+func openArchiveMember(archive, member string) (fs.File, error) {
+	format, _ := archiveFormat(archive)
+	if format == ZIP {
+		reader, err := zip.OpenReader(archive)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range reader.File {
+			if entry.Name != member || !entry.Mode().IsRegular() {
+				continue
+			}
+			content, err := entry.Open()
+			if err != nil {
+				reader.Close()
+				return nil, err
+			}
+			return &archiveMember{ReadCloser: content, info: entry.FileInfo(), archive: reader}, nil
+		}
+		reader.Close()
+		return nil, &fs.PathError{Op: "open", Path: archiveMemberPath(archive, member), Err: fs.ErrNotExist}
+	}
+
+	var content []byte
+	var info fs.FileInfo
+	err := walkTarArchive(archive, format == TARGZ, func(header *tar.Header, reader io.Reader) error {
+		if header.Name != member || header.Typeflag != tar.TypeReg {
+			return nil
+		}
+		var err error
+		content, err = io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		info = header.FileInfo()
+		return errArchiveMemberFound
+	})
+	if err != nil && !errors.Is(err, errArchiveMemberFound) {
+		return nil, err
+	}
+	if info == nil {
+		return nil, &fs.PathError{Op: "open", Path: archiveMemberPath(archive, member), Err: fs.ErrNotExist}
+	}
+	return &archiveMember{ReadCloser: io.NopCloser(bytes.NewReader(content)), info: info}, nil
+}
+
+// archiveMember is an open archive member. Members of zip archives keep the
+// archive open until they are closed.
+type archiveMember struct {
+	io.ReadCloser
+	info    fs.FileInfo
+	archive *zip.ReadCloser
+}
+
+func (m *archiveMember) Stat() (fs.FileInfo, error) {
+	return m.info, nil
+}
+
+func (m *archiveMember) Close() error {
+	err := m.ReadCloser.Close()
+	if m.archive != nil {
+		err = errors.Join(err, m.archive.Close())
+	}
+	return err
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestGetFilesFromArchive(t *testing.T) {
+	var tempDir string = t.TempDir()
+	var src string = path.Join(tempDir, "photo.jpg")
+	if err := os.WriteFile(src, []byte("photo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	md5sum, err := md5sumFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []DestinationFormat{ZIP, TAR, TARGZ} {
+		var options ProgramOptions = ProgramOptions{
+			Destination:       path.Join(tempDir, "backup."+format.String()),
+			DestinationFormat: format,
+		}
+		if _, err := writeArchive(options, Files{{Name: "photo.jpg", Path: src, Md5sum: md5sum}}); err != nil {
+			t.Fatal(err)
+		}
+
+		files, err := getFilesFromFolders([]string{options.Destination})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 1 {
+			t.Fatalf("expected 1 file in %s but got %d", options.Destination, len(files))
+		}
+		var expectedPath string = options.Destination + "!photo.jpg"
+		if files[0].Name != "photo.jpg" || files[0].Path != expectedPath || files[0].Md5sum != md5sum {
+			t.Errorf("expected photo.jpg at %s with md5 sum %s but got %s", expectedPath, md5sum, files[0])
+		}
+
+		var dst string = path.Join(tempDir, "extracted-"+format.String()+".jpg")
+		if _, err := copyFile(files[0].Path, dst, PreserveAttributes{Mode: true, Times: true, Xattrs: true}); err != nil {
+			t.Fatalf("unexpected error extracting %s: %s", files[0].Path, err.Error())
+		}
+		if extracted, _ := md5sumFile(dst); extracted != md5sum {
+			t.Errorf("expected extracted %s to match %s", dst, src)
+		}
+
+		if _, err := copyFile(options.Destination+"!missing.jpg", dst+".missing", PreserveAttributes{}); err == nil {
+			t.Errorf("expected error extracting missing member from %s", options.Destination)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestWriteArchive(t *testing.T) {
+	var tempDir string = t.TempDir()
+	var pickedFiles Files = Files{}
+	for _, folder := range []string{"a", "b"} {
+		if err := os.Mkdir(path.Join(tempDir, folder), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		var src string = path.Join(tempDir, folder, "photo.jpg")
+		if err := os.WriteFile(src, []byte(folder), 0644); err != nil {
+			t.Fatal(err)
+		}
+		md5sum, err := md5sumFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pickedFiles = append(pickedFiles, File{Name: "photo.jpg", Path: src, Md5sum: md5sum})
+	}
+
+	for _, format := range []DestinationFormat{ZIP, TAR, TARGZ} {
+		var options ProgramOptions = ProgramOptions{
+			Destination:       path.Join(tempDir, "output."+format.String()),
+			DestinationFormat: format,
+			DestinationOption: APPEND,
+			Verify:            true,
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := writeArchive(options, pickedFiles); err != nil {
+				t.Fatalf("unexpected error writing %s: %s", format.String(), err.Error())
+			}
+		}
+		md5sums, err := archiveMemberMd5sums(options.Destination, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string = []string{}
+		for name := range md5sums {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var expectedNames string = "photo-1.jpg,photo-2.jpg,photo-3.jpg,photo.jpg"
+		if strings.Join(names, ",") != expectedNames {
+			t.Errorf("expected %s in %s but got %s", expectedNames, format.String(), strings.Join(names, ","))
+		}
+		if md5sums["photo-1.jpg"] != pickedFiles[1].Md5sum {
+			t.Errorf("expected photo-1.jpg to be a copy of %s", pickedFiles[1].Path)
+		}
+
+		options.DestinationOption = PANIC
+		if _, err := writeArchive(options, pickedFiles); err == nil {
+			t.Errorf("expected error writing to existing %s archive", format.String())
+		}
+	}
+}
+
+func TestWriteArchiveVerification(t *testing.T) {
+	var tempDir string = t.TempDir()
+	var pickedFiles Files = Files{}
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		var src string = path.Join(tempDir, name)
+		if err := os.WriteFile(src, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		md5sum, err := md5sumFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pickedFiles = append(pickedFiles, File{Name: name, Path: src, Md5sum: md5sum})
+	}
+	var options ProgramOptions = ProgramOptions{
+		Destination:       path.Join(tempDir, "output.zip"),
+		DestinationFormat: ZIP,
+		DestinationOption: APPEND,
+		Verify:            true,
+		VerifyRetries:     1,
+	}
+	if _, err := writeArchive(options, pickedFiles[2:]); err != nil {
+		t.Fatal(err)
+	}
+
+	// A corrupted copy of b.jpg is simulated with the md5 sum of c.jpg, which
+	// is kept in the archive.
+	pickedFiles[1].Md5sum = pickedFiles[2].Md5sum
+	placed, err := writeArchive(options, pickedFiles[:2])
+	var verificationError *VerificationError
+	if !errors.As(err, &verificationError) {
+		t.Fatalf("expected verification error but got %v", err)
+	}
+	if len(verificationError.Files) != 1 || verificationError.Files[0].Name != "b.jpg" {
+		t.Errorf("expected verification of b.jpg to fail but got %s", verificationError.Files)
+	}
+	if len(placed) != 1 || placed[pickedFiles[0].Path] != archiveMemberPath(options.Destination, "a.jpg") {
+		t.Errorf("expected only a.jpg to be placed but got %v", placed)
+	}
+	md5sums, err := archiveMemberMd5sums(options.Destination, ZIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := md5sums["b.jpg"]; ok || len(md5sums) != 2 {
+		t.Errorf("expected a.jpg and c.jpg in the archive but got %v", md5sums)
+	}
+}
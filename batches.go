@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// currentBatchLink is the name of the symbolic link in the destination folder
+// that points to the most recent batch.
+const currentBatchLink string = "current"
+
+// defaultBatchNameFormat is the default time layout used to name batch
+// folders.
+const defaultBatchNameFormat string = "2006-01-02"
+
+// batch is a dated batch folder in the destination folder.
+type batch struct {
+	name    string
+	created time.Time
+}
+
+// copyFilesToBatch copies the picked files into a new dated batch folder
+// inside the destination folder, points the `current` link at it, and prunes
+// the oldest batches so that at most `options.KeepBatches` batches remain. The
+// destination paths of the picked files are returned keyed by their source
+// path.
+func copyFilesToBatch(options ProgramOptions, pickedFiles Files, now time.Time) (map[string]string, error) {
+	var batchName string = now.Format(options.BatchNameFormat)
+	if batchName == "" || strings.Contains(batchName, "/") {
+		return nil, fmt.Errorf("invalid batch folder name '%s' from format '%s'", batchName, options.BatchNameFormat)
+	}
+	var batchFolder string = path.Join(options.Destination, batchName)
+
+	log.Info().Msgf("copying files into batch folder %s", batchFolder)
+	err := os.MkdirAll(batchFolder, os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("error creating batch folder %s: %s", batchFolder, err.Error())
+	}
+	previouslyPlaced, err := readManifest(batchFolder)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	placed, err := copyPickedFiles(batchFolder, pickedFiles, true, options)
+	var verificationError *VerificationError
+	if err != nil && !errors.As(err, &verificationError) {
+		return nil, err
+	}
+	manifestErr := writeManifest(batchFolder, append(previouslyPlaced, placedNames(placed)...))
+	if manifestErr != nil {
+		return nil, manifestErr
+	}
+	linkErr := updateCurrentBatchLink(options.Destination, batchName)
+	if linkErr != nil {
+		return nil, linkErr
+	}
+	pruneErr := pruneBatches(options.Destination, options.BatchNameFormat, options.KeepBatches, batchName)
+	if pruneErr != nil {
+		return nil, pruneErr
+	}
+	return placedPaths(batchFolder, placed), err
+}
+
+// updateCurrentBatchLink points the `current` link in `destination` at the
+// batch folder `batchName`. The link is replaced atomically.
+func updateCurrentBatchLink(destination, batchName string) error {
+	var link string = path.Join(destination, currentBatchLink)
+	var temporaryLink string = link + ".new"
+	os.Remove(temporaryLink)
+	err := os.Symlink(batchName, temporaryLink)
+	if err != nil {
+		return fmt.Errorf("cannot create link %s: %s", temporaryLink, err.Error())
+	}
+	err = os.Rename(temporaryLink, link)
+	if err != nil {
+		os.Remove(temporaryLink)
+		return fmt.Errorf("cannot update link %s: %s", link, err.Error())
+	}
+	log.Debug().Msgf("pointed %s at %s", link, batchName)
+	return nil
+}
+
+// listBatches returns the batch folders in `destination` sorted from oldest to
+// newest. Only folders whose name matches `format` are considered batches.
+func listBatches(destination, format string) ([]batch, error) {
+	dirEntries, err := os.ReadDir(destination)
+	if err != nil {
+		return nil, err
+	}
+	var batches []batch = []batch{}
+	for _, entry := range dirEntries {
+		if !entry.IsDir() {
+			continue
+		}
+		created, err := time.Parse(format, entry.Name())
+		if err != nil {
+			log.Debug().Msgf("%s is not a batch folder", entry.Name())
+			continue
+		}
+		batches = append(batches, batch{name: entry.Name(), created: created})
+	}
+	sort.SliceStable(batches, func(i, j int) bool {
+		if batches[i].created.Equal(batches[j].created) {
+			return batches[i].name < batches[j].name
+		}
+		return batches[i].created.Before(batches[j].created)
+	})
+	return batches, nil
+}
+
+// pruneBatches removes the oldest batch folders in `destination` such that at
+// most `keep` batches remain. The batch `current` is never removed. A
+// non-positive `keep` keeps all batches.
+func pruneBatches(destination, format string, keep int, current string) error {
+	if keep <= 0 {
+		return nil
+	}
+	batches, err := listBatches(destination, format)
+	if err != nil {
+		return fmt.Errorf("unable to read destination folder %s: %s", destination, err.Error())
+	}
+	for i := 0; i < len(batches)-keep; i++ {
+		if batches[i].name == current {
+			continue
+		}
+		log.Info().Msgf("pruning batch %s", batches[i].name)
+		err = os.RemoveAll(path.Join(destination, batches[i].name))
+		if err != nil {
+			return fmt.Errorf("cannot remove batch %s: %s", batches[i].name, err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestCopyFilesToBatch(t *testing.T) {
+	var tempDir string = t.TempDir()
+	var src string = path.Join(tempDir, "a.jpg")
+	if err := os.WriteFile(src, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var destination string = path.Join(tempDir, "output")
+	var options ProgramOptions = ProgramOptions{
+		Destination:       destination,
+		DestinationOption: ROTATE,
+		BatchNameFormat:   defaultBatchNameFormat,
+		KeepBatches:       2,
+	}
+	var start time.Time = time.Date(2026, 10, 16, 11, 0, 0, 0, time.UTC)
+	for day := 0; day < 3; day++ {
+		_, err := copyFilesToBatch(options, Files{File{Name: "a.jpg", Path: src}}, start.AddDate(0, 0, day))
+		if err != nil {
+			t.Fatalf("unexpected error %s", err.Error())
+		}
+	}
+
+	batches, err := listBatches(destination, defaultBatchNameFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 2 || batches[0].name != "2026-10-17" || batches[1].name != "2026-10-18" {
+		t.Errorf("expected batches 2026-10-17 and 2026-10-18 but got %v", batches)
+	}
+	link, err := os.Readlink(path.Join(destination, currentBatchLink))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link != "2026-10-18" {
+		t.Errorf("expected current link to point at 2026-10-18 but got %s", link)
+	}
+	if _, err := os.Stat(path.Join(destination, currentBatchLink, "a.jpg")); err != nil {
+		t.Errorf("expected a.jpg in current batch")
+	}
+}
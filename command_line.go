@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 	"path"
+	"strings"
 
 	"github.com/juju/gnuflag"
 	"github.com/rs/zerolog/log"
@@ -29,6 +30,29 @@ Usage Example
 
 Would choose at random 20 files from folder1 and folder2 (including sub-folders) and copy those files into output. The output is created if it does not exist already. In this example, only files with suffixes .jpg or .avi are considered.
 
+Commands
+--------
+
+    pick-files watch --folder folder1 --folder folder2
+
+Keeps the database current with the files in folder1 and folder2 by watching the folders for changes until interrupted. Runs with --skip-scan then pick from the database without scanning the folders.
+
+    pick-files daemon --config config.yaml
+
+Picks files for every profile in the profiles section of config.yaml on the profile's cron-style schedule, e.g. "0 11 * * *" for every day at 11:00. The options of a profile supersede the options at the top level of the configuration file. Send SIGHUP to reload the configuration file.
+
+    pick-files serve --config config.yaml
+
+Serves an HTTP API for dashboards and photo frames: GET /api/profiles lists the profiles of config.yaml, POST /api/profiles/NAME/picks with Content-Type application/json picks files for the profile NAME, GET /api/profiles/NAME/picks lists the files of the last pick, GET /api/statistics shows the database statistics, and GET /api/files/MD5SUM fetches a file. The options at the top level of config.yaml are available as profile "default". Further endpoints list the pick history (GET /api/history), list the files ordered by how often they were picked (GET /api/files?order=least-picked or most-picked), fetch thumbnails (GET /api/files/MD5SUM/thumbnail), and ban or favourite a file (PATCH /api/files/MD5SUM with {"banned": true} or {"favourite": true}). Banned files are not picked anymore and favourites are picked twice as often. The API has no authentication and therefore only listens on localhost:8080 by default; use e.g. --listen :8080 to allow access from other machines.
+
+    pick-files ui --config config.yaml
+
+Serves a web UI on top of the API showing the current picks as thumbnails, the pick history, and the least and most picked files, with buttons to re-roll the picks of a profile and to ban or favourite a file.
+
+    pick-files systemd install --schedule "*-*-* 11:00" --config config.yaml
+
+Installs and enables a systemd user service and timer which pick files with config.yaml on the given schedule. Use "pick-files systemd status" to show when files are picked next and "pick-files systemd uninstall" to remove the units again.
+
 `)
 	// Read tips and tricks
 	f, err := os.Open("/usr/share/doc/pick-files/tips-and-tricks.rst")
@@ -46,6 +70,19 @@ Would choose at random 20 files from folder1 and folder2 (including sub-folders)
 	gnuflag.PrintDefaults()
 }
 
+// commands lists the commands that can be given instead of picking files.
+var commands []string = []string{"daemon", "serve", "systemd", "ui", "watch"}
+
+// isCommand returns true if `name` is a known command.
+func isCommand(name string) bool {
+	for _, command := range commands {
+		if command == name {
+			return true
+		}
+	}
+	return false
+}
+
 // parseCommandline parses the command line arguments and stores the option
 // values.
 func parseCommandline(options ProgramOptions) ProgramOptions {
@@ -57,15 +94,56 @@ func parseCommandline(options ProgramOptions) ProgramOptions {
 	gnuflag.BoolVar(&options.verboseRequested, "verbose", false, "Verbose output.")
 	gnuflag.BoolVar(&options.dryRun, "dry-run", false, "If set then the chosen files are only shown and not copied.")
 	gnuflag.Var(&options.Folders, "folder", "A folder PATH to consider when picking files; can be used multiple times; "+
-		"works recursively, meaning all sub-folders and their files are included in the selection.")
+		"works recursively, meaning all sub-folders and their files are included in the selection; "+
+		"the PATH can also be a zip or tar archive whose members are then considered as files, "+
+		"a WebDAV URL of the form dav://user@host/path (davs:// for https) with the password "+
+		"in the environment variable "+webdavPasswordVariable+", "+
+		"an SFTP URL of the form sftp://user@host:port/path using the SSH agent or the private key in "+sshKeyVariable+", "+
+		"or an S3 URL of the form s3://bucket/prefix using the AWS_ENDPOINT_URL, AWS_REGION, AWS_ACCESS_KEY_ID, "+
+		"and AWS_SECRET_ACCESS_KEY environment variables.")
+	gnuflag.StringVar(&options.FilesFrom, "files-from", "", "Read the files to consider when picking files from this FILE, "+
+		"separated by newlines or NUL characters, in addition to the --folder options; the special name `-` means standard input.")
+	gnuflag.StringVar(&options.listen, "listen", "localhost:8080", "The ADDRESS on which `pick-files serve` and `pick-files ui` serve the API and the web UI.")
+	gnuflag.StringVar(&options.NotifyWebhook, "notify-webhook", "", "POST a JSON summary of the picked files, counts, errors, "+
+		"and duration to this URL after every run; the body is signed with HMAC-SHA256 using the secret in the environment variable "+
+		webhookSecretVariable+" and the signature sent in the "+webhookSignatureHeader+" header.")
 	gnuflag.IntVar(&options.NumberOfFiles, "number", 1, "The number of files to choose.")
 	gnuflag.IntVar(&options.NumberOfFiles, "N", 1, "The number of files to choose.")
 	gnuflag.StringVar(&options.Destination, "destination", "output", "The output PATH for the "+
-		"selected files.")
-	gnuflag.Var(&options.DestinationOption, "destination-option", "What to do when writing to destination; possible options are panic, append, and delete.")
+		"selected files; can also be a WebDAV, SFTP, or S3 URL like for --folder, which supports the panic, append, "+
+		"and delete destination options.")
+	gnuflag.Var(&options.DestinationFormat, "destination-format", "How to write the selected files; possible options are dir, zip, tar, and tar.gz. "+
+		"The archive formats write the files into an archive at the destination PATH.")
+	gnuflag.Var(&options.DestinationOption, "destination-option", "What to do when writing to destination; possible options are panic, append, delete, trash, atomic, rotate, and sync. "+
+		"The trash option moves existing files in the destination to the trash instead of deleting them. "+
+		"The atomic option copies the files into a staging folder first and swaps it into place, keeping the previous destination as DESTINATION.prev. "+
+		"The rotate option copies the files into a new dated batch folder inside the destination and points the 'current' link at it. "+
+		"The sync option only removes stale files from and copies new files into the destination.")
+	gnuflag.IntVar(&options.CopyJobs, "copy-jobs", 1, "The number of files to copy to the destination concurrently.")
+	gnuflag.BoolVar(&options.ForceClean, "force-clean", false, "Remove all files in the destination folder with the delete, trash, "+
+		"and sync destination options, not only the files placed there by previous runs.")
+	gnuflag.StringVar(&options.BatchNameFormat, "batch-name-format", defaultBatchNameFormat, "The name of the batch folders "+
+		"created with --destination-option rotate, given as Go time layout.")
+	gnuflag.IntVar(&options.KeepBatches, "keep-batches", 0, "The number of batch folders to keep with --destination-option rotate; "+
+		"older batches are removed. By default, all batches are kept.")
 	gnuflag.BoolVar(&deleteExisting, "delete-existing", false, "Delete existing files in the "+
 		"destination folder instead of moving those files to a new location (deprecated, use --destination-option delete).")
 	gnuflag.BoolVar(&appendFiles, "append", false, "Append chosen files to existing destination folder (deprecated, use --destination-option append).")
+	gnuflag.Var(&options.Output, "output", "Print the picked files to standard output, also with --dry-run; possible options are json, "+
+		"ndjson, paths, and paths0. The paths options print the destination paths (or source paths if the files are not copied) "+
+		"separated by newlines or NUL characters.")
+	gnuflag.StringVar(&options.Playlist, "playlist", "", "Write a playlist of the selected files to this FILE; the format is "+
+		"chosen by the extension, possible options are .m3u, .m3u8, .pls, and .xspf. The playlist lists the copies in the destination "+
+		"folder, or the source files with --playlist-only or --dry-run.")
+	gnuflag.BoolVar(&options.PlaylistOnly, "playlist-only", false, "Only write the playlist and do not copy the selected files; "+
+		"unlike --dry-run the files are still marked as picked.")
+	gnuflag.BoolVar(&options.PlaylistRelative, "playlist-relative", false, "Write paths relative to the playlist folder into the playlist "+
+		"instead of absolute paths.")
+	gnuflag.Var(&options.Preserve, "preserve", "Preserve these attributes of the source files on the copied files; a comma separated "+
+		"list of mode, times, and xattrs (or all); can be used multiple times.")
+	gnuflag.BoolVar(&options.Verify, "verify", false, "Verify the copied files by comparing their md5 sum with the source; "+
+		"files that cannot be copied correctly are not marked as picked and the run fails.")
+	gnuflag.IntVar(&options.VerifyRetries, "verify-retries", 2, "The number of times a file is copied again if its verification failed.")
 	gnuflag.BoolVar(&options.printVersion, "version", false, "Print the version of this program.")
 	gnuflag.Var(&options.Suffixes, "suffix", "Only consider files with this SUFFIX. For instance, to only load "+
 		"jpeg files you would specify either 'jpg' or '.jpg'. By default, all files are considered.")
@@ -76,7 +154,13 @@ func parseCommandline(options ProgramOptions) ProgramOptions {
 	gnuflag.Var(&options.printDatabaseFormat, "print-database-format", "Format of printed database; possible options are CSV, JSON, and YAML.")
 	gnuflag.StringVar(&options.BlockSelectionString, "block-selection", "", "Block selection of files for a certain "+
 		"period. Possible units are (s)econds, (m)inutes, (h)ours, (d)days, and (w)weeks.")
+	gnuflag.BoolVar(&options.HTMLGallery, "html-gallery", false, "Write an index.html with thumbnails and a slideshow of the selected "+
+		"files into the destination folder; open index.html#slideshow to start the slideshow right away.")
 	gnuflag.BoolVar(&options.journalDLogging, "journald", false, "Log to journald.")
+	gnuflag.StringVar(&options.schedule, "schedule", defaultSystemdSchedule, "When to pick files with the units installed by "+
+		"`pick-files systemd install`, given as systemd OnCalendar expression.")
+	gnuflag.BoolVar(&options.SkipScan, "skip-scan", false, "Do not scan the folders but pick from the files recorded in the "+
+		"database; requires `pick-files watch` running on the same folders to keep the database current.")
 	gnuflag.BoolVar(&options.printDatabaseStatistics, "print-database-statistics", false, "Print some statistics of the internal database.")
 	gnuflag.StringVar(&options.configurationFile, "config", "", "Use configuration file")
 	gnuflag.BoolVar(&options.dumpConfiguration, "dump-configuration", false, "Dump current configuration; output can be used as configuration file.")
@@ -84,7 +168,30 @@ func parseCommandline(options ProgramOptions) ProgramOptions {
 	gnuflag.Parse(true)
 	adjustLogLevel(options)
 
-	options = loadConfigurationFile(options)
+	if gnuflag.NArg() > 0 {
+		options.command = gnuflag.Arg(0)
+		if !isCommand(options.command) {
+			log.Fatal().Msgf("unknown command %s", options.command)
+		}
+		var arguments []string = gnuflag.Args()[1:]
+		if options.command == "systemd" {
+			if len(arguments) == 0 || !isSystemdAction(arguments[0]) {
+				log.Fatal().Msgf("the systemd command requires one of %s", strings.Join(systemdActions, ", "))
+			}
+			options.systemdAction = arguments[0]
+			arguments = arguments[1:]
+		}
+		if len(arguments) > 0 {
+			log.Fatal().Msgf("unexpected arguments %s", strings.Join(arguments, " "))
+		}
+	}
+
+	var commandLine ProgramOptions = options
+	options, err := loadConfigurationFile(options)
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+	options.commandLine = &commandLine
 
 	if deleteExisting {
 		log.Warn().Msg("This option is deprecated: Use --destination-option delete")
@@ -110,7 +217,14 @@ func parseCommandline(options ProgramOptions) ProgramOptions {
 		os.Exit(0)
 	}
 	if options.BlockSelectionString != "" {
-		options.blockSelectionDuration = convertDurationString(options.BlockSelectionString).Abs()
+		duration, err := convertDurationString(options.BlockSelectionString)
+		if err != nil {
+			log.Fatal().Msg(err.Error())
+		}
+		options.blockSelectionDuration = duration.Abs()
+	}
+	if options.PlaylistOnly && options.Playlist == "" {
+		log.Fatal().Msg("--playlist-only requires --playlist")
 	}
 	if options.DestinationOption == UNSET {
 		options.DestinationOption = PANIC
@@ -16,39 +16,168 @@ func dumpConfiguration(options ProgramOptions) {
 
 // loadConfigurationFile loads configuration options from file and merges the
 // existing options `o` with the read options where the options from file
-// supersede the existing options.
-func loadConfigurationFile(o ProgramOptions) ProgramOptions {
+// supersede the existing options. If the options in the file are invalid then
+// `o` is returned with an error.
+func loadConfigurationFile(o ProgramOptions) (ProgramOptions, error) {
 	var newOptions ProgramOptions = ProgramOptions{}
 	lines, err := os.ReadFile(o.configurationFile)
 	if err != nil {
 		log.Debug().Msgf("could not open configuration file %s", o.configurationFile)
-		return o
+		return o, nil
 	}
 	newOptions.DestinationOption = UNSET
 	err = yaml.Unmarshal(lines, &newOptions)
 	if err != nil {
 		log.Warn().Msgf("could not read configuration file: %s", err.Error())
 	}
+	result, err := mergeOptions(o, newOptions)
+	if err != nil {
+		return o, fmt.Errorf("invalid configuration file %s: %w", o.configurationFile, err)
+	}
+	if newOptions.Profiles != nil {
+		result.Profiles = newOptions.Profiles
+	}
+	for name := range result.Profiles {
+		_, err = profileOptions(result, name)
+		if err != nil {
+			return o, fmt.Errorf("invalid configuration file %s: profile %s: %w", o.configurationFile, name, err)
+		}
+	}
+	log.Debug().Msgf("loaded configuration: %s", result.String())
+	return result, nil
+}
+
+// mergeOptions merges the options `newOptions` read from a configuration file
+// into the options `o`; the options set in `newOptions` supersede the options
+// in `o`.
+func mergeOptions(o ProgramOptions, newOptions ProgramOptions) (ProgramOptions, error) {
 	var result ProgramOptions = o
+	if newOptions.BatchNameFormat != "" {
+		result.BatchNameFormat = newOptions.BatchNameFormat
+	}
 	if newOptions.BlockSelectionString != "" {
 		result.BlockSelectionString = newOptions.BlockSelectionString
-		result.blockSelectionDuration = convertDurationString(newOptions.BlockSelectionString).Abs()
+		duration, err := convertDurationString(newOptions.BlockSelectionString)
+		if err != nil {
+			return o, err
+		}
+		result.blockSelectionDuration = duration.Abs()
+	}
+	if newOptions.CopyJobs != 0 {
+		result.CopyJobs = newOptions.CopyJobs
 	}
 	if newOptions.Destination != "" {
 		result.Destination = newOptions.Destination
 	}
+	if newOptions.DestinationFormat != DIRECTORY {
+		result.DestinationFormat = newOptions.DestinationFormat
+	}
 	if newOptions.DestinationOption != UNSET {
 		result.DestinationOption = newOptions.DestinationOption
 	}
+	if newOptions.Email != nil {
+		result.Email = newOptions.Email
+	}
+	if newOptions.FilesFrom != "" {
+		result.FilesFrom = newOptions.FilesFrom
+	}
 	if newOptions.Folders != nil {
 		result.Folders = newOptions.Folders
 	}
+	if newOptions.ForceClean {
+		result.ForceClean = newOptions.ForceClean
+	}
+	if newOptions.HTMLGallery {
+		result.HTMLGallery = newOptions.HTMLGallery
+	}
+	if newOptions.KeepBatches != 0 {
+		result.KeepBatches = newOptions.KeepBatches
+	}
+	if newOptions.NotifyWebhook != "" {
+		result.NotifyWebhook = newOptions.NotifyWebhook
+	}
 	if newOptions.NumberOfFiles != 0 {
 		result.NumberOfFiles = newOptions.NumberOfFiles
 	}
+	if newOptions.Output != NOOUTPUT {
+		result.Output = newOptions.Output
+	}
+	if newOptions.Playlist != "" {
+		result.Playlist = newOptions.Playlist
+	}
+	if newOptions.PlaylistOnly {
+		result.PlaylistOnly = newOptions.PlaylistOnly
+	}
+	if newOptions.PlaylistRelative {
+		result.PlaylistRelative = newOptions.PlaylistRelative
+	}
+	if newOptions.Preserve != (PreserveAttributes{}) {
+		result.Preserve = newOptions.Preserve
+	}
+	if newOptions.SkipScan {
+		result.SkipScan = newOptions.SkipScan
+	}
 	if newOptions.Suffixes != nil {
 		result.Suffixes = newOptions.Suffixes
 	}
-	log.Debug().Msgf("loaded configuration: %s", result.String())
-	return result
+	if newOptions.Verify {
+		result.Verify = newOptions.Verify
+	}
+	if newOptions.VerifyRetries != 0 {
+		result.VerifyRetries = newOptions.VerifyRetries
+	}
+	return result, nil
+}
+
+// reloadConfiguration reads the configuration file again and merges it with
+// the command line options `options` were created from, so that options
+// removed from the file are reset. If the configuration file is invalid then
+// `options` is returned with an error.
+func reloadConfiguration(options ProgramOptions) (ProgramOptions, error) {
+	if options.commandLine == nil {
+		return loadConfigurationFile(options)
+	}
+	result, err := loadConfigurationFile(*options.commandLine)
+	if err != nil {
+		return options, err
+	}
+	result.commandLine = options.commandLine
+	if result.DestinationOption == UNSET {
+		result.DestinationOption = PANIC
+	}
+	return result, nil
+}
+
+// Profile is a named set of options in the configuration file which is picked
+// on its own schedule by `pick-files daemon`. The options of a profile
+// supersede the options at the top level of the configuration file.
+type Profile struct {
+	Schedule string         `yaml:"schedule"`
+	Options  ProgramOptions `yaml:",inline"`
+}
+
+// UnmarshalYAML reads a profile and leaves the destination option of the
+// profile unset if the profile does not set it.
+func (p *Profile) UnmarshalYAML(value *yaml.Node) error {
+	var schedule struct {
+		Schedule string `yaml:"schedule"`
+	}
+	err := value.Decode(&schedule)
+	if err != nil {
+		return err
+	}
+	p.Schedule = schedule.Schedule
+	p.Options = ProgramOptions{DestinationOption: UNSET}
+	return value.Decode(&p.Options)
+}
+
+// profileOptions returns the options for picking the profile `name`.
+func profileOptions(options ProgramOptions, name string) (ProgramOptions, error) {
+	result, err := mergeOptions(options, options.Profiles[name].Options)
+	if err != nil {
+		return options, err
+	}
+	result.profile = name
+	result.Profiles = nil
+	return result, nil
 }
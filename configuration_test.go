@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestDumpConfiguration(t *testing.T) {
+	var options ProgramOptions = ProgramOptions{
+		Destination:       "output.zip",
+		DestinationFormat: ZIP,
+		DestinationOption: ATOMIC,
+		Folders:           Folders{"photos"},
+		NumberOfFiles:     5,
+		Output:            JSONOUTPUT,
+		Preserve:          PreserveAttributes{Mode: true},
+		Profiles: map[string]Profile{
+			"frame": {Schedule: "@daily", Options: ProgramOptions{DestinationOption: UNSET, Output: PATHSOUTPUT}},
+		},
+	}
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout *os.File = os.Stdout
+	os.Stdout = writer
+	dumpConfiguration(options)
+	os.Stdout = stdout
+	writer.Close()
+	dump, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var config string = path.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, dump, 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadConfigurationFile(ProgramOptions{configurationFile: config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.DestinationFormat != ZIP || loaded.DestinationOption != ATOMIC || loaded.Output != JSONOUTPUT ||
+		loaded.NumberOfFiles != 5 || loaded.Destination != "output.zip" || loaded.Folders.String() != "photos" ||
+		loaded.Preserve != options.Preserve {
+		t.Errorf("configuration did not survive the round trip, dumped\n%s", dump)
+	}
+	var frame Profile = loaded.Profiles["frame"]
+	if frame.Schedule != "@daily" || frame.Options.DestinationOption != UNSET || frame.Options.Output != PATHSOUTPUT {
+		t.Errorf("profile did not survive the round trip, dumped\n%s", dump)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed cron-style schedule with the fields minute, hour,
+// day of month, month, and day of week. Each field is a bit set of the values
+// it matches.
+type cronSchedule struct {
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+	// anyDay and anyWeekday are true if the day of month or the day of week
+	// field is `*`. If both fields are restricted then a day matches if
+	// either field matches, like in cron.
+	anyDay     bool
+	anyWeekday bool
+}
+
+// cronMacros maps the supported cron macros to their schedules.
+var cronMacros map[string]string = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronMonthNames and cronWeekdayNames are the names that can be used instead
+// of numbers in the month and day of week fields.
+var cronMonthNames []string = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+var cronWeekdayNames []string = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// parseCronSchedule parses a cron-style schedule with five fields, e.g.
+// `0 11 * * *` for every day at 11:00, or one of the macros like @daily.
+// Fields can be `*`, numbers, ranges like 1-5, lists like 1,15, and steps like
+// */15 or 8-18/2.
+func parseCronSchedule(schedule string) (cronSchedule, error) {
+	var result cronSchedule
+	if macro, ok := cronMacros[strings.ToLower(strings.TrimSpace(schedule))]; ok {
+		schedule = macro
+	}
+	var fields []string = strings.Fields(schedule)
+	if len(fields) != 5 {
+		return result, fmt.Errorf("schedule %q must have 5 fields (minute, hour, day of month, month, day of week)", schedule)
+	}
+	var err error
+	result.minutes, err = parseCronField(fields[0], 0, 59, nil)
+	if err != nil {
+		return result, fmt.Errorf("schedule %q: minute: %w", schedule, err)
+	}
+	result.hours, err = parseCronField(fields[1], 0, 23, nil)
+	if err != nil {
+		return result, fmt.Errorf("schedule %q: hour: %w", schedule, err)
+	}
+	result.days, err = parseCronField(fields[2], 1, 31, nil)
+	if err != nil {
+		return result, fmt.Errorf("schedule %q: day of month: %w", schedule, err)
+	}
+	result.months, err = parseCronField(fields[3], 1, 12, cronMonthNames)
+	if err != nil {
+		return result, fmt.Errorf("schedule %q: month: %w", schedule, err)
+	}
+	// Sunday can be given as 0 or 7.
+	result.weekdays, err = parseCronField(fields[4], 0, 7, cronWeekdayNames)
+	if err != nil {
+		return result, fmt.Errorf("schedule %q: day of week: %w", schedule, err)
+	}
+	if result.weekdays&(1<<7) != 0 {
+		result.weekdays |= 1
+	}
+	result.anyDay = strings.HasPrefix(fields[2], "*")
+	result.anyWeekday = strings.HasPrefix(fields[4], "*")
+	return result, nil
+}
+
+// parseCronValue parses a single value of a cron field, either a number or one
+// of `names` which count from `min`.
+func parseCronValue(value string, min, max int, names []string) (int, error) {
+	for i, name := range names {
+		if strings.EqualFold(value, name) {
+			return min + i, nil
+		}
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	if number < min || number > max {
+		return 0, fmt.Errorf("value %d out of range %d-%d", number, min, max)
+	}
+	return number, nil
+}
+
+// parseCronField parses a cron field with values between `min` and `max` and
+// returns the bit set of matching values.
+func parseCronField(field string, min, max int, names []string) (uint64, error) {
+	var result uint64
+	for _, part := range strings.Split(field, ",") {
+		var step int = 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			part = part[:i]
+		}
+		var first, last int
+		switch {
+		case part == "*":
+			first, last = min, max
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			first, err = parseCronValue(bounds[0], min, max, names)
+			if err != nil {
+				return 0, err
+			}
+			last, err = parseCronValue(bounds[1], min, max, names)
+			if err != nil {
+				return 0, err
+			}
+			if last < first {
+				return 0, fmt.Errorf("invalid range %q", part)
+			}
+		default:
+			var err error
+			first, err = parseCronValue(part, min, max, names)
+			if err != nil {
+				return 0, err
+			}
+			last = first
+			if step > 1 {
+				// A step after a single value like 5/15 means from that
+				// value to the end of the range.
+				last = max
+			}
+		}
+		for value := first; value <= last; value += step {
+			result |= 1 << value
+		}
+	}
+	return result, nil
+}
+
+// matchesDay returns true if the schedule runs on the day of `t`.
+func (c cronSchedule) matchesDay(t time.Time) bool {
+	var day bool = c.days&(1<<t.Day()) != 0
+	var weekday bool = c.weekdays&(1<<int(t.Weekday())) != 0
+	if c.anyDay || c.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+// next returns the first time after `after` at which the schedule runs, in the
+// time zone of `after`. The zero time is returned if the schedule never runs,
+// e.g. for the 31st of February.
+func (c cronSchedule) next(after time.Time) time.Time {
+	var t time.Time = after.Truncate(time.Minute).Add(time.Minute)
+	// Every valid schedule runs at least once within 5 years (leap days).
+	var limit time.Time = t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.months&(1<<int(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hours&(1<<t.Hour()) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minutes&(1<<t.Minute()) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	var after time.Time = time.Date(2024, 2, 27, 11, 30, 15, 0, time.UTC)
+	var tests []struct {
+		schedule string
+		expected time.Time
+	} = []struct {
+		schedule string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2024, 2, 27, 11, 31, 0, 0, time.UTC)},
+		{"0 11 * * *", time.Date(2024, 2, 28, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 2, 28, 0, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 2, 27, 11, 45, 0, 0, time.UTC)},
+		{"5/20 8-18/2 * * *", time.Date(2024, 2, 27, 12, 5, 0, 0, time.UTC)},
+		{"0 9 * * sat,sun", time.Date(2024, 3, 2, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2024, 3, 3, 9, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)},
+		// With both day fields restricted either one has to match.
+		{"0 0 1 * mon", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 15 * fri", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, test := range tests {
+		schedule, err := parseCronSchedule(test.schedule)
+		if err != nil {
+			t.Errorf("unexpected error parsing %q: %s", test.schedule, err.Error())
+			continue
+		}
+		var next time.Time = schedule.next(after)
+		if !next.Equal(test.expected) {
+			t.Errorf("expected %q to run next at %s but got %s", test.schedule, test.expected, next)
+		}
+	}
+}
+
+func TestParseCronScheduleErrors(t *testing.T) {
+	for _, schedule := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8",
+		"*/0 * * * *", "5-1 * * * *", "x * * * *", "* * * foo *"} {
+		if _, err := parseCronSchedule(schedule); err == nil {
+			t.Errorf("expected error parsing %q", schedule)
+		}
+	}
+}
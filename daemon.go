@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// daemonPollInterval is the longest the daemon sleeps before checking the
+// clock again. Timers do not advance while the system is suspended, so
+// sleeping until the next run in one go could miss it by the time the system
+// was suspended.
+var daemonPollInterval time.Duration = time.Minute
+
+// scheduledProfile is a profile with the time it is picked next.
+type scheduledProfile struct {
+	name     string
+	schedule cronSchedule
+	options  ProgramOptions
+	next     time.Time
+}
+
+// daemon picks the scheduled profiles of the configuration when they are due.
+type daemon struct {
+	options  ProgramOptions
+	profiles []scheduledProfile
+	// run picks the files of a profile.
+	run func(ProgramOptions) ([]Pick, error)
+}
+
+// scheduleProfiles returns the profiles in `options` with their next run
+// after `now`. Profiles without a schedule are skipped.
+func scheduleProfiles(options ProgramOptions, now time.Time) ([]scheduledProfile, error) {
+	var names []string = []string{}
+	for name := range options.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var profiles []scheduledProfile = []scheduledProfile{}
+	for _, name := range names {
+		var profile Profile = options.Profiles[name]
+		if profile.Schedule == "" {
+			log.Warn().Msgf("profile %s has no schedule, skipping", name)
+			continue
+		}
+		schedule, err := parseCronSchedule(profile.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+		picking, err := profileOptions(options, name)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+		var scheduled scheduledProfile = scheduledProfile{
+			name:     name,
+			schedule: schedule,
+			options:  picking,
+			next:     schedule.next(now),
+		}
+		if !scheduled.options.hasSources() {
+			return nil, fmt.Errorf("profile %s has no folders", name)
+		}
+		if scheduled.next.IsZero() {
+			return nil, fmt.Errorf("profile %s: schedule %q never runs", name, profile.Schedule)
+		}
+		profiles = append(profiles, scheduled)
+	}
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("no scheduled profiles found in configuration file %s", options.configurationFile)
+	}
+	return profiles, nil
+}
+
+// nextRun returns the time of the next scheduled run of any profile.
+func (d *daemon) nextRun() time.Time {
+	var next time.Time = d.profiles[0].next
+	for _, profile := range d.profiles[1:] {
+		if profile.next.Before(next) {
+			next = profile.next
+		}
+	}
+	return next
+}
+
+// runDue picks the profiles that are due at `now` and schedules their next
+// runs. Runs missed, e.g. while the system was suspended, are only made up
+// once.
+func (d *daemon) runDue(now time.Time) {
+	for i := range d.profiles {
+		var profile *scheduledProfile = &d.profiles[i]
+		if profile.next.After(now) {
+			continue
+		}
+		log.Info().Msgf("picking files for profile %s", profile.name)
+		picks, err := d.run(profile.options)
+		if err != nil {
+			log.Error().Msgf("picking files for profile %s failed: %s", profile.name, err.Error())
+		} else {
+			log.Info().Msgf("picked %d file(s) for profile %s", len(picks), profile.name)
+		}
+		profile.next = profile.schedule.next(time.Now())
+		log.Info().Msgf("next run of profile %s at %s", profile.name, profile.next.Format(time.RFC1123))
+	}
+}
+
+// reload reads the configuration file again and reschedules the profiles. If
+// the new configuration is invalid then the current schedule is kept.
+func (d *daemon) reload(now time.Time) {
+	log.Info().Msgf("reloading configuration file %s", d.options.configurationFile)
+	options, err := reloadConfiguration(d.options)
+	if err != nil {
+		log.Error().Msgf("keeping current configuration: %s", err.Error())
+		return
+	}
+	profiles, err := scheduleProfiles(options, now)
+	if err != nil {
+		log.Error().Msgf("keeping current configuration: %s", err.Error())
+		return
+	}
+	d.options = options
+	d.profiles = profiles
+	d.logSchedule()
+}
+
+// logSchedule logs the next run of every profile.
+func (d *daemon) logSchedule() {
+	for _, profile := range d.profiles {
+		log.Info().Msgf("profile %s scheduled for %s", profile.name, profile.next.Format(time.RFC1123))
+	}
+}
+
+// loop runs the profiles on schedule until SIGINT or SIGTERM is received on
+// `signals`; SIGHUP reloads the configuration file. A run in progress is
+// finished before the daemon stops.
+func (d *daemon) loop(signals <-chan os.Signal) {
+	d.logSchedule()
+	for {
+		var wait time.Duration = time.Until(d.nextRun())
+		if wait > daemonPollInterval {
+			wait = daemonPollInterval
+		}
+		var timer *time.Timer = time.NewTimer(wait)
+		select {
+		case <-timer.C:
+			d.runDue(time.Now())
+		case received := <-signals:
+			timer.Stop()
+			if received == syscall.SIGHUP {
+				d.reload(time.Now())
+				continue
+			}
+			log.Info().Msgf("received %s, stopping", received.String())
+			return
+		}
+	}
+}
+
+// runDaemon runs `pick-files daemon`: it picks the files of the profiles in
+// the configuration file on their schedules until it is stopped.
+func runDaemon(options ProgramOptions) {
+	// When started by systemd the output goes to the journal anyway; log
+	// there directly so that the journal records the log levels.
+	if os.Getenv("JOURNAL_STREAM") != "" {
+		useJournalD()
+	}
+	if options.configurationFile == "" {
+		log.Fatal().Msg("The daemon requires a configuration file with profiles. Use the --config option.")
+	}
+	log.Info().Msgf("%s-%s daemon starting", path.Base(os.Args[0]), Version)
+	profiles, err := scheduleProfiles(options, time.Now())
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+	var signals chan os.Signal = make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	var d *daemon = &daemon{
+		options:  options,
+		profiles: profiles,
+		run:      runPicks,
+	}
+	d.loop(signals)
+}
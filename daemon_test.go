@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestDaemon(t *testing.T) {
+	var config string = path.Join(t.TempDir(), "config.yaml")
+	var content string = `destination-option: delete
+folder:
+  - photos
+number: 10
+profiles:
+  daily:
+    schedule: "0 11 * * *"
+    destination: daily
+  weekend:
+    schedule: "30 9 * * sat,sun"
+    destination: weekend
+    destination-option: append
+    folder:
+      - videos
+    number: 2
+  manual:
+    destination: manual
+`
+	if err := os.WriteFile(config, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var commandLine ProgramOptions = ProgramOptions{configurationFile: config, Verify: true}
+	options, err := loadConfigurationFile(commandLine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options.commandLine = &commandLine
+
+	var now time.Time = time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	profiles, err := scheduleProfiles(options, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 2 || profiles[0].name != "daily" || profiles[1].name != "weekend" {
+		t.Fatalf("expected the daily and weekend profiles but got %v", profiles)
+	}
+	var daily ProgramOptions = profiles[0].options
+	if daily.Destination != "daily" || daily.DestinationOption != DELETE || daily.NumberOfFiles != 10 ||
+		daily.Folders.String() != "photos" || !daily.Verify {
+		t.Errorf("unexpected options of the daily profile: %+v", daily)
+	}
+	var weekend ProgramOptions = profiles[1].options
+	if weekend.Destination != "weekend" || weekend.DestinationOption != APPEND || weekend.NumberOfFiles != 2 ||
+		weekend.Folders.String() != "videos" {
+		t.Errorf("unexpected options of the weekend profile: %+v", weekend)
+	}
+	if !profiles[0].next.Equal(time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC)) ||
+		!profiles[1].next.Equal(time.Date(2024, 3, 2, 9, 30, 0, 0, time.UTC)) {
+		t.Errorf("unexpected next runs %s and %s", profiles[0].next, profiles[1].next)
+	}
+
+	var picked []string = []string{}
+	var d *daemon = &daemon{
+		options:  options,
+		profiles: profiles,
+		run: func(options ProgramOptions) ([]Pick, error) {
+			picked = append(picked, options.Destination)
+			return nil, nil
+		},
+	}
+	if !d.nextRun().Equal(profiles[0].next) {
+		t.Errorf("expected next run at %s but got %s", profiles[0].next, d.nextRun())
+	}
+	d.runDue(time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC))
+	if len(picked) != 1 || picked[0] != "daily" {
+		t.Errorf("expected only the daily profile to be picked but got %v", picked)
+	}
+	if !d.profiles[0].next.After(time.Now()) {
+		t.Errorf("expected the daily profile to be rescheduled but got %s", d.profiles[0].next)
+	}
+
+	if err := os.WriteFile(config, []byte("profiles:\n  hourly:\n    schedule: '@hourly'\n    folder: [music]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d.reload(now)
+	if len(d.profiles) != 1 || d.profiles[0].name != "hourly" {
+		t.Fatalf("expected the hourly profile after reloading but got %v", d.profiles)
+	}
+	if d.profiles[0].options.Destination != "" || d.profiles[0].options.DestinationOption != PANIC || !d.profiles[0].options.Verify {
+		t.Errorf("expected options removed from the configuration to be reset: %+v", d.profiles[0].options)
+	}
+
+	if err := os.WriteFile(config, []byte("profiles:\n  broken:\n    schedule: '61 * * * *'\n    folder: [music]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d.reload(now)
+	if len(d.profiles) != 1 || d.profiles[0].name != "hourly" {
+		t.Errorf("expected the hourly profile to be kept after an invalid configuration but got %v", d.profiles)
+	}
+
+	for _, content := range []string{
+		"block-selection: 1x\nprofiles:\n  broken:\n    schedule: '@daily'\n    folder: [music]\n",
+		"profiles:\n  broken:\n    schedule: '@daily'\n    folder: [music]\n    block-selection: 1x\n",
+	} {
+		if err := os.WriteFile(config, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		d.reload(now)
+		if len(d.profiles) != 1 || d.profiles[0].name != "hourly" {
+			t.Errorf("expected the hourly profile to be kept after an invalid block selection but got %v", d.profiles)
+		}
+	}
+}
@@ -154,8 +154,50 @@ func storeDB(allFiles Files) {
 	if err != nil {
 		log.Fatal().Msgf("error marshalling data: %s", err.Error())
 	}
-	err = os.WriteFile(getDBPath(), encoded, 0644)
+	// Write to a temporary file first so that a concurrent reader, e.g. a
+	// pick run while `pick-files watch` is running, never sees a partially
+	// written database.
+	temporary, err := os.CreateTemp(path.Dir(getDBPath()), path.Base(getDBPath())+".*.tmp")
 	if err != nil {
 		log.Fatal().Msgf("error writing database: %s", err.Error())
 	}
+	_, err = temporary.Write(encoded)
+	if err == nil {
+		err = temporary.Chmod(0644)
+	}
+	if closeErr := temporary.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temporary.Name(), getDBPath())
+	}
+	if err != nil {
+		os.Remove(temporary.Name())
+		log.Fatal().Msgf("error writing database: %s", err.Error())
+	}
+}
+
+// lockDB takes an exclusive lock on the database and returns the function
+// releasing it. Processes updating the database, e.g. a pick run and
+// `pick-files watch`, hold the lock from loading to storing the database so
+// that they do not overwrite each other's changes.
+func lockDB() func() {
+	lock, err := os.OpenFile(getDBPath()+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		log.Fatal().Msgf("error opening database lock: %s", err.Error())
+	}
+	err = lockFile(lock)
+	if err != nil {
+		lock.Close()
+		log.Fatal().Msgf("error locking database: %s", err.Error())
+	}
+	return func() { lock.Close() }
+}
+
+// updateDB loads the database, applies `change` to it, and stores the result
+// while holding the database lock.
+func updateDB(change func(Files) Files) {
+	unlock := lockDB()
+	defer unlock()
+	storeDB(change(loadDB()))
 }
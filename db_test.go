@@ -1,7 +1,11 @@
 package main
 
 import (
+	"fmt"
+	"os"
 	"path"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -39,3 +43,30 @@ func TestExpireOldDBEntries(t *testing.T) {
 		t.Errorf("Got %s, Expected %s", files, expectedFiles)
 	}
 }
+
+func TestUpdateDB(t *testing.T) {
+	t.Setenv("SNAP_USER_DATA", t.TempDir())
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			updateDB(func(files Files) Files {
+				return append(files, File{Name: fmt.Sprintf("%d.jpg", i), Md5sum: fmt.Sprintf("%d", i)})
+			})
+		}(i)
+	}
+	wg.Wait()
+	if files := loadDB(); len(files) != 20 {
+		t.Errorf("expected 20 records but got %d", len(files))
+	}
+	entries, err := os.ReadDir(path.Dir(getDBPath()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			t.Errorf("expected no temporary database files but found %s", entry.Name())
+		}
+	}
+}
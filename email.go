@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	_ "embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// smtpPasswordVariable is the environment variable holding the password of the
+// SMTP user.
+const smtpPasswordVariable string = "PICK_FILES_SMTP_PASSWORD"
+
+// defaultEmailImageSize is the default maximum width and height of the images
+// in the email digest in pixels.
+const defaultEmailImageSize int = 1024
+
+// defaultEmailSubject is the default subject of the email digest.
+const defaultEmailSubject string = "Today's memories"
+
+//go:embed templates/digest.html
+var digestTemplateSource string
+
+var digestTemplate = template.Must(template.New("digest").Parse(digestTemplateSource))
+
+// EmailSettings configures the email digest of the picked files sent after
+// every run.
+type EmailSettings struct {
+	// Server is the SMTP server as HOST:PORT. Port 465 uses TLS, other ports
+	// use STARTTLS if the server supports it.
+	Server   string   `yaml:"server"`
+	Username string   `yaml:"username"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+	Subject  string   `yaml:"subject"`
+	// Inline shows the images in the HTML body instead of attaching them.
+	Inline    bool `yaml:"inline"`
+	ImageSize int  `yaml:"image-size"`
+}
+
+type digestItem struct {
+	Name      string
+	ContentID string
+}
+
+type digestPage struct {
+	Subject string
+	Date    string
+	Items   []digestItem
+}
+
+// digestImage is a resized image of the digest.
+type digestImage struct {
+	name      string
+	contentID string
+	content   []byte
+}
+
+// resizeImage returns the image `filename` scaled down to fit into `size` by
+// `size` pixels, for the email digest.
+func resizeImage(filename string, size int, contentID string) (digestImage, error) {
+	content, err := makeThumbnail(filename, size)
+	if err != nil {
+		return digestImage{}, err
+	}
+	return digestImage{
+		name:      strings.TrimSuffix(path.Base(filename), path.Ext(filename)) + ".jpg",
+		contentID: contentID,
+		content:   content,
+	}, nil
+}
+
+// writeBase64 writes `content` base64 encoded in lines of 76 characters.
+func writeBase64(w io.Writer, content []byte) error {
+	var encoded string = base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(w, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err := io.WriteString(w, encoded+"\r\n")
+	return err
+}
+
+// composeDigest returns the email message with the picked files `picks`
+// sent at `now`.
+func composeDigest(settings EmailSettings, picks []Pick, now time.Time) ([]byte, error) {
+	var size int = settings.ImageSize
+	if size <= 0 {
+		size = defaultEmailImageSize
+	}
+	var subject string = settings.Subject
+	if subject == "" {
+		subject = defaultEmailSubject
+	}
+	var images []digestImage = []digestImage{}
+	var page digestPage = digestPage{Subject: subject, Date: now.Format("2 January 2006"), Items: []digestItem{}}
+	for i, pick := range picks {
+		var item digestItem = digestItem{Name: path.Base(pick.Source)}
+		if isImage(pick.Source) {
+			image, err := resizeImage(pick.Source, size, fmt.Sprintf("image%d@pick-files", i))
+			if err != nil {
+				log.Warn().Msgf("cannot add %s to the email digest: %s", pick.Source, err.Error())
+			} else {
+				images = append(images, image)
+				if settings.Inline {
+					item.ContentID = image.contentID
+				}
+			}
+		}
+		page.Items = append(page.Items, item)
+	}
+	var html bytes.Buffer
+	err := digestTemplate.Execute(&html, page)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering email digest: %s", err.Error())
+	}
+
+	var message bytes.Buffer
+	var body *multipart.Writer = multipart.NewWriter(&message)
+	var contentType string = "multipart/mixed"
+	if settings.Inline {
+		contentType = "multipart/related"
+	}
+	fmt.Fprintf(&message, "From: %s\r\n", settings.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(settings.To, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: %s; boundary=%s\r\n\r\n", contentType, body.Boundary())
+
+	part, err := body.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = writeBase64(part, html.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	for _, image := range images {
+		var header textproto.MIMEHeader = textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType("image/jpeg", map[string]string{"name": image.name})},
+			"Content-Transfer-Encoding": {"base64"},
+		}
+		if settings.Inline {
+			header.Set("Content-ID", "<"+image.contentID+">")
+			header.Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": image.name}))
+		} else {
+			header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": image.name}))
+		}
+		part, err := body.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		err = writeBase64(part, image.content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = body.Close()
+	if err != nil {
+		return nil, err
+	}
+	return message.Bytes(), nil
+}
+
+// sendMail sends `message` through the SMTP server in `settings`.
+func sendMail(settings EmailSettings, message []byte) error {
+	host, port, err := net.SplitHostPort(settings.Server)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP server %s: %w", settings.Server, err)
+	}
+	var dialer *net.Dialer = &net.Dialer{Timeout: 30 * time.Second}
+	var connection net.Conn
+	if port == "465" {
+		connection, err = tls.DialWithDialer(dialer, "tcp", settings.Server, &tls.Config{ServerName: host})
+	} else {
+		connection, err = dialer.Dial("tcp", settings.Server)
+	}
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(connection, host)
+	if err != nil {
+		connection.Close()
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok && port != "465" {
+		err = client.StartTLS(&tls.Config{ServerName: host})
+		if err != nil {
+			return err
+		}
+	}
+	if settings.Username != "" {
+		// PlainAuth refuses to send the password without TLS unless the
+		// server is on localhost.
+		err = client.Auth(smtp.PlainAuth("", settings.Username, os.Getenv(smtpPasswordVariable), host))
+		if err != nil {
+			return err
+		}
+	}
+	err = client.Mail(settings.From)
+	if err != nil {
+		return err
+	}
+	for _, to := range settings.To {
+		err = client.Rcpt(to)
+		if err != nil {
+			return err
+		}
+	}
+	data, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = data.Write(message)
+	if err != nil {
+		return err
+	}
+	err = data.Close()
+	if err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// sendDigest emails the picked files `picks` as configured in `settings`.
+func sendDigest(settings EmailSettings, picks []Pick, now time.Time) error {
+	if settings.Server == "" || settings.From == "" || len(settings.To) == 0 {
+		return errors.New("the email digest requires the server, from, and to settings")
+	}
+	message, err := composeDigest(settings, picks, now)
+	if err != nil {
+		return err
+	}
+	err = sendMail(settings, message)
+	if err != nil {
+		return fmt.Errorf("cannot send email digest: %w", err)
+	}
+	log.Info().Msgf("sent email digest with %d file(s) to %s", len(picks), strings.Join(settings.To, ", "))
+	return nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpSink is a minimal SMTP server which records the messages it receives.
+type smtpSink struct {
+	listener   net.Listener
+	auth       string
+	recipients []string
+	messages   chan []byte
+}
+
+// newSMTPSink starts an SMTP sink on a local port.
+func newSMTPSink(t *testing.T) *smtpSink {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sink *smtpSink = &smtpSink{listener: listener, messages: make(chan []byte, 1)}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			connection, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go sink.serve(connection)
+		}
+	}()
+	return sink
+}
+
+// serve answers the SMTP commands on `connection`.
+func (s *smtpSink) serve(connection net.Conn) {
+	defer connection.Close()
+	var text *textproto.Conn = textproto.NewConn(connection)
+	text.PrintfLine("220 localhost sink")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		var command string = strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO":
+			text.PrintfLine("250-localhost")
+			text.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			credentials, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "AUTH PLAIN "))
+			s.auth = string(credentials)
+			text.PrintfLine("235 authenticated")
+		case "MAIL":
+			text.PrintfLine("250 ok")
+		case "RCPT":
+			s.recipients = append(s.recipients, strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>"))
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			message, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.messages <- message
+			text.PrintfLine("250 ok")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func TestSendDigest(t *testing.T) {
+	var tempDir string = t.TempDir()
+	var photo string = path.Join(tempDir, "photo.png")
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 2000, 1000))); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(photo, encoded.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var picks []Pick = []Pick{
+		{Source: photo, Md5sum: "photo"},
+		{Source: path.Join(tempDir, "video.avi"), Md5sum: "video"},
+	}
+	var sink *smtpSink = newSMTPSink(t)
+	t.Setenv(smtpPasswordVariable, "password")
+
+	for _, inline := range []bool{false, true} {
+		var settings EmailSettings = EmailSettings{
+			Server:    sink.listener.Addr().String(),
+			Username:  "frame",
+			From:      "frame@example.com",
+			To:        []string{"grandma@example.com", "grandpa@example.com"},
+			Inline:    inline,
+			ImageSize: 500,
+		}
+		sink.recipients = nil
+		if err := sendDigest(settings, picks, time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC)); err != nil {
+			t.Fatal(err)
+		}
+		var received []byte = <-sink.messages
+		if sink.auth != "\x00frame\x00password" {
+			t.Errorf("unexpected credentials %q", sink.auth)
+		}
+		if strings.Join(sink.recipients, ",") != "grandma@example.com,grandpa@example.com" {
+			t.Errorf("unexpected recipients %v", sink.recipients)
+		}
+
+		message, err := mail.ReadMessage(bufio.NewReader(bytes.NewReader(received)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if message.Header.Get("Subject") != defaultEmailSubject {
+			t.Errorf("unexpected subject %s", message.Header.Get("Subject"))
+		}
+		mediaType, parameters, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var expectedType string = "multipart/mixed"
+		if inline {
+			expectedType = "multipart/related"
+		}
+		if mediaType != expectedType {
+			t.Errorf("expected %s but got %s", expectedType, mediaType)
+		}
+		var reader *multipart.Reader = multipart.NewReader(message.Body, parameters["boundary"])
+		var parts []*multipart.Part = []*multipart.Part{}
+		var contents [][]byte = [][]byte{}
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+			if err != nil {
+				t.Fatal(err)
+			}
+			parts = append(parts, part)
+			contents = append(contents, content)
+		}
+		if len(parts) != 2 {
+			t.Fatalf("expected the HTML body and one image but got %d parts", len(parts))
+		}
+		var html string = string(contents[0])
+		if !strings.Contains(html, "photo.png") || !strings.Contains(html, "video.avi") {
+			t.Errorf("expected both files to be listed in\n%s", html)
+		}
+		if inline != strings.Contains(html, `src="cid:image0@pick-files"`) {
+			t.Errorf("unexpected inline image reference in\n%s", html)
+		}
+		var disposition string = "attachment"
+		if inline {
+			disposition = "inline"
+		}
+		if !strings.HasPrefix(parts[1].Header.Get("Content-Disposition"), disposition) || parts[1].FileName() != "photo.jpg" {
+			t.Errorf("unexpected image part %v", parts[1].Header)
+		}
+		config, err := jpeg.DecodeConfig(bytes.NewReader(contents[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Width != 500 || config.Height != 250 {
+			t.Errorf("expected image resized to 500x250 but got %dx%d", config.Width, config.Height)
+		}
+	}
+
+	if err := sendDigest(EmailSettings{Server: sink.listener.Addr().String()}, picks, time.Now()); err == nil {
+		t.Errorf("expected error without sender and recipients")
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	exifTagImageDescription uint16 = 0x010e
+	exifTagExifIFDPointer   uint16 = 0x8769
+	exifTagDateTimeOriginal uint16 = 0x9003
+	exifTypeASCII           uint16 = 2
+	exifTypeLong            uint16 = 4
+	exifDateFormat          string = "2006:01:02 15:04:05"
+)
+
+var errNoExifMetadata = errors.New("no EXIF metadata found")
+
+// exifMetadata holds the EXIF tags used for captions.
+type exifMetadata struct {
+	DateTimeOriginal time.Time
+	ImageDescription string
+}
+
+// readExifMetadata reads the EXIF metadata from the APP1 segment of a JPEG
+// image.
+func readExifMetadata(r io.Reader) (exifMetadata, error) {
+	reader := bufio.NewReader(r)
+	var marker [2]byte
+	if _, err := io.ReadFull(reader, marker[:]); err != nil || marker != [2]byte{0xff, 0xd8} {
+		return exifMetadata{}, errNoExifMetadata
+	}
+	for {
+		if _, err := io.ReadFull(reader, marker[:]); err != nil || marker[0] != 0xff {
+			return exifMetadata{}, errNoExifMetadata
+		}
+		// The image data starts with SOS; EXIF metadata has to come before.
+		if marker[1] == 0xda || marker[1] == 0xd9 {
+			return exifMetadata{}, errNoExifMetadata
+		}
+		var length uint16
+		if err := binary.Read(reader, binary.BigEndian, &length); err != nil || length < 2 {
+			return exifMetadata{}, errNoExifMetadata
+		}
+		if marker[1] != 0xe1 {
+			if _, err := reader.Discard(int(length) - 2); err != nil {
+				return exifMetadata{}, errNoExifMetadata
+			}
+			continue
+		}
+		segment := make([]byte, length-2)
+		if _, err := io.ReadFull(reader, segment); err != nil {
+			return exifMetadata{}, errNoExifMetadata
+		}
+		if bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return parseExifTIFF(segment[6:])
+		}
+	}
+}
+
+// parseExifTIFF parses the TIFF structure holding the EXIF tags.
+func parseExifTIFF(data []byte) (exifMetadata, error) {
+	var metadata exifMetadata
+	if len(data) < 8 {
+		return metadata, errNoExifMetadata
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return metadata, errNoExifMetadata
+	}
+	ifd0 := readExifIFD(data, order, order.Uint32(data[4:8]))
+	if entry, ok := ifd0[exifTagImageDescription]; ok {
+		metadata.ImageDescription = exifASCII(data, order, entry)
+	}
+	if entry, ok := ifd0[exifTagExifIFDPointer]; ok && entry.valueType == exifTypeLong {
+		exifIFD := readExifIFD(data, order, order.Uint32(entry.value[:]))
+		if entry, ok := exifIFD[exifTagDateTimeOriginal]; ok {
+			dateTime, err := time.ParseInLocation(exifDateFormat, exifASCII(data, order, entry), time.Local)
+			if err == nil {
+				metadata.DateTimeOriginal = dateTime
+			}
+		}
+	}
+	return metadata, nil
+}
+
+type exifEntry struct {
+	valueType uint16
+	count     uint32
+	value     [4]byte
+}
+
+// readExifIFD returns the entries of the image file directory at `offset`.
+func readExifIFD(data []byte, order binary.ByteOrder, offset uint32) map[uint16]exifEntry {
+	var entries map[uint16]exifEntry = map[uint16]exifEntry{}
+	if uint64(offset)+2 > uint64(len(data)) {
+		return entries
+	}
+	var count int = int(order.Uint16(data[offset:]))
+	for i := 0; i < count; i++ {
+		var start uint64 = uint64(offset) + 2 + uint64(i)*12
+		if start+12 > uint64(len(data)) {
+			break
+		}
+		var entry exifEntry = exifEntry{
+			valueType: order.Uint16(data[start+2:]),
+			count:     order.Uint32(data[start+4:]),
+		}
+		copy(entry.value[:], data[start+8:start+12])
+		entries[order.Uint16(data[start:])] = entry
+	}
+	return entries
+}
+
+// exifASCII returns the value of an ASCII entry.
+func exifASCII(data []byte, order binary.ByteOrder, entry exifEntry) string {
+	if entry.valueType != exifTypeASCII {
+		return ""
+	}
+	var value []byte
+	if entry.count <= 4 {
+		value = entry.value[:entry.count]
+	} else {
+		var offset uint64 = uint64(order.Uint32(entry.value[:]))
+		if offset+uint64(entry.count) > uint64(len(data)) {
+			return ""
+		}
+		value = data[offset : offset+uint64(entry.count)]
+	}
+	return strings.TrimSpace(strings.TrimRight(string(value), "\x00"))
+}
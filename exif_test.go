@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// writeEntry writes a little endian IFD entry.
+func writeEntry(b *bytes.Buffer, tag, valueType uint16, count, value uint32) {
+	binary.Write(b, binary.LittleEndian, struct {
+		Tag, Type    uint16
+		Count, Value uint32
+	}{tag, valueType, count, value})
+}
+
+// buildExifJPEG returns the start of a JPEG file with an APP1 segment holding
+// the EXIF tags ImageDescription and DateTimeOriginal.
+func buildExifJPEG(description, dateTime string) []byte {
+	var tiff bytes.Buffer
+	var order = binary.LittleEndian
+	var descriptionValue []byte = append([]byte(description), 0)
+	var dateTimeValue []byte = append([]byte(dateTime), 0)
+	// Layout: header (8), IFD0 with 2 entries (2+24+4), Exif IFD with 1 entry
+	// (2+12+4), followed by the string values.
+	var exifIFDOffset uint32 = 8 + 30
+	var descriptionOffset uint32 = exifIFDOffset + 18
+	var dateTimeOffset uint32 = descriptionOffset + uint32(len(descriptionValue))
+
+	tiff.WriteString("II")
+	binary.Write(&tiff, order, uint16(42))
+	binary.Write(&tiff, order, uint32(8))
+	binary.Write(&tiff, order, uint16(2))
+	writeEntry(&tiff, exifTagImageDescription, exifTypeASCII, uint32(len(descriptionValue)), descriptionOffset)
+	writeEntry(&tiff, exifTagExifIFDPointer, exifTypeLong, 1, exifIFDOffset)
+	binary.Write(&tiff, order, uint32(0))
+	binary.Write(&tiff, order, uint16(1))
+	writeEntry(&tiff, exifTagDateTimeOriginal, exifTypeASCII, uint32(len(dateTimeValue)), dateTimeOffset)
+	binary.Write(&tiff, order, uint32(0))
+	tiff.Write(descriptionValue)
+	tiff.Write(dateTimeValue)
+
+	var jpeg bytes.Buffer
+	jpeg.Write([]byte{0xff, 0xd8, 0xff, 0xe1})
+	binary.Write(&jpeg, binary.BigEndian, uint16(2+6+tiff.Len()))
+	jpeg.WriteString("Exif\x00\x00")
+	jpeg.Write(tiff.Bytes())
+	jpeg.Write([]byte{0xff, 0xda})
+	return jpeg.Bytes()
+}
+
+func TestReadExifMetadata(t *testing.T) {
+	metadata, err := readExifMetadata(bytes.NewReader(buildExifJPEG("Grandma's birthday", "2019:07:14 15:30:00")))
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	if metadata.ImageDescription != "Grandma's birthday" {
+		t.Errorf("expected description \"Grandma's birthday\" but got %q", metadata.ImageDescription)
+	}
+	var expectedDateTime time.Time = time.Date(2019, 7, 14, 15, 30, 0, 0, time.Local)
+	if !metadata.DateTimeOriginal.Equal(expectedDateTime) {
+		t.Errorf("expected date %s but got %s", expectedDateTime, metadata.DateTimeOriginal)
+	}
+
+	_, err = readExifMetadata(bytes.NewReader([]byte("not a jpeg")))
+	if err != errNoExifMetadata {
+		t.Errorf("expected %s but got %v", errNoExifMetadata, err)
+	}
+}
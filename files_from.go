@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rs/zerolog/log"
+)
+
+// splitFileList splits a list of filenames separated by newlines, or by NUL
+// characters if the list contains any, e.g. from `find -print0`. Empty entries
+// are dropped.
+func splitFileList(content []byte) []string {
+	var separator []byte = []byte("\n")
+	if bytes.IndexByte(content, 0) >= 0 {
+		separator = []byte{0}
+	}
+	var filenames []string = []string{}
+	for _, entry := range bytes.Split(content, separator) {
+		entry = bytes.TrimSuffix(entry, []byte("\r"))
+		if len(entry) > 0 {
+			filenames = append(filenames, string(entry))
+		}
+	}
+	return filenames
+}
+
+// getFilesFromList reads the candidate files from the list in file `list`;
+// the special name `-` means standard input. Folders in the list are read
+// recursively like folders given with --folder.
+func getFilesFromList(list string) (Files, error) {
+	var reader io.Reader = os.Stdin
+	if list != "-" {
+		f, err := os.Open(list)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open file list %s: %w", list, err)
+		}
+		defer f.Close()
+		reader = f
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file list %s: %w", list, err)
+	}
+
+	var files Files = Files{}
+	for _, filename := range splitFileList(content) {
+		info, err := os.Stat(filename)
+		if err != nil {
+			log.Warn().Msgf("skipping %s: %s", filename, err.Error())
+			continue
+		}
+		if info.IsDir() {
+			folderFiles, err := getFilesFromFolders([]string{filename})
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, folderFiles...)
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			log.Warn().Msgf("skipping %s, not a regular file", filename)
+			continue
+		}
+		file, err := newFileFromPath(filename)
+		if err != nil {
+			log.Warn().Msg(err.Error())
+			continue
+		}
+		files = append(files, file)
+	}
+	log.Debug().Msgf("found %d files in file list %s", len(files), list)
+	return files, nil
+}
+
+// uniqueFiles returns `files` without repeated paths.
+func uniqueFiles(files Files) Files {
+	var seen map[string]bool = map[string]bool{}
+	var result Files = Files{}
+	for _, file := range files {
+		if seen[file.Path] {
+			continue
+		}
+		seen[file.Path] = true
+		result = append(result, file)
+	}
+	return result
+}
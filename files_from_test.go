@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestSplitFileList(t *testing.T) {
+	var testInput []string = []string{
+		"a.jpg\nb c.jpg\n\n",
+		"a.jpg\r\nb c.jpg\r\n",
+		"a.jpg\x00b c.jpg\x00",
+	}
+	for _, input := range testInput {
+		var filenames []string = splitFileList([]byte(input))
+		if strings.Join(filenames, "|") != "a.jpg|b c.jpg" {
+			t.Errorf("expected a.jpg|b c.jpg for %q but got %s", input, strings.Join(filenames, "|"))
+		}
+	}
+}
+
+func TestGetFilesFromList(t *testing.T) {
+	var tempDir string = t.TempDir()
+	if err := os.Mkdir(path.Join(tempDir, "folder"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.jpg", "folder/b.jpg"} {
+		if err := os.WriteFile(path.Join(tempDir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var list string = path.Join(tempDir, "list")
+	var content string = strings.Join([]string{
+		path.Join(tempDir, "a.jpg"),
+		path.Join(tempDir, "folder"),
+		path.Join(tempDir, "missing.jpg"),
+	}, "\x00")
+	if err := os.WriteFile(list, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := getFilesFromList(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].Name != "a.jpg" || files[1].Name != "b.jpg" {
+		t.Errorf("expected a.jpg and b.jpg but got %s", files)
+	}
+	if files[0].Md5sum == "" {
+		t.Errorf("expected md5 sum of a.jpg to be computed")
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"path"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// galleryFilename is the name of the gallery page in the destination folder.
+const galleryFilename string = "index.html"
+
+// gallerySlideInterval is the time each file is shown in the slideshow.
+const gallerySlideInterval time.Duration = 10 * time.Second
+
+//go:embed templates/gallery.html
+var galleryTemplateSource string
+
+var galleryTemplate = template.Must(template.New("gallery").Parse(galleryTemplateSource))
+
+type galleryItem struct {
+	Name      string
+	Caption   string
+	Date      string
+	IsImage   bool
+	Thumbnail template.URL
+}
+
+type galleryPage struct {
+	Generated     string
+	IntervalMilli int64
+	Items         []galleryItem
+}
+
+// newGalleryItem collects the thumbnail and the caption of the file `name` in
+// `folder`. The caption is taken from the EXIF metadata of the file if
+// present and otherwise from its name and modification time.
+func newGalleryItem(folder, name string) (galleryItem, error) {
+	var filename string = path.Join(folder, name)
+	info, err := os.Stat(filename)
+	if err != nil {
+		return galleryItem{}, err
+	}
+	var item galleryItem = galleryItem{
+		Name:    name,
+		Caption: name,
+		Date:    info.ModTime().Format("2 January 2006"),
+		IsImage: isImage(name),
+	}
+	if !item.IsImage {
+		return item, nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return item, err
+	}
+	metadata, err := readExifMetadata(file)
+	file.Close()
+	if err == nil {
+		if metadata.ImageDescription != "" {
+			item.Caption = metadata.ImageDescription
+		}
+		if !metadata.DateTimeOriginal.IsZero() {
+			item.Date = metadata.DateTimeOriginal.Format("2 January 2006")
+		}
+	}
+	thumbnail, err := makeThumbnail(filename, thumbnailSize)
+	if err != nil {
+		log.Warn().Msgf("cannot create thumbnail of %s: %s", filename, err.Error())
+		return item, nil
+	}
+	item.Thumbnail = template.URL("data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(thumbnail))
+	return item, nil
+}
+
+// writeGallery writes a gallery page with thumbnails and a slideshow of the
+// files placed into `folder` by pick-files. The thumbnails are embedded into
+// the page so that the gallery consists of a single file, which is added to
+// the manifest so that it is cleaned up like the picked files.
+func writeGallery(folder string, now time.Time) error {
+	names, err := readManifest(folder)
+	if errors.Is(err, os.ErrNotExist) {
+		names = []string{}
+	} else if err != nil {
+		return err
+	}
+	var page galleryPage = galleryPage{
+		Generated:     now.Format("2 January 2006 15:04"),
+		IntervalMilli: gallerySlideInterval.Milliseconds(),
+		Items:         []galleryItem{},
+	}
+	for _, name := range names {
+		if name == galleryFilename {
+			continue
+		}
+		item, err := newGalleryItem(folder, name)
+		if err != nil {
+			log.Warn().Msgf("skipping %s in gallery: %s", name, err.Error())
+			continue
+		}
+		page.Items = append(page.Items, item)
+	}
+
+	var content bytes.Buffer
+	err = galleryTemplate.Execute(&content, page)
+	if err != nil {
+		return fmt.Errorf("error rendering gallery: %s", err.Error())
+	}
+	err = os.WriteFile(path.Join(folder, galleryFilename), content.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing gallery in %s: %s", folder, err.Error())
+	}
+	err = writeManifest(folder, append(names, galleryFilename))
+	if err != nil {
+		return err
+	}
+	log.Info().Msgf("wrote gallery with %d file(s) into %s", len(page.Items), folder)
+	return nil
+}
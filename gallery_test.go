@@ -0,0 +1,66 @@
+package main
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteGallery(t *testing.T) {
+	var folder string = t.TempDir()
+	file, err := os.Create(path.Join(folder, "photo.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(file, image.NewRGBA(image.Rect(0, 0, 640, 480))); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	if err := os.WriteFile(path.Join(folder, "movie.mp4"), []byte("movie"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(folder, "foreign.png"), []byte("foreign"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeManifest(folder, []string{"photo.png", "movie.mp4"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeGallery(folder, time.Now()); err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	content, err := os.ReadFile(path.Join(folder, galleryFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"2 file(s) picked", `src="data:image/jpeg;base64,`, `name: "movie.mp4"`, `name: "photo.png"`} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("expected gallery to contain %s", expected)
+		}
+	}
+	if strings.Contains(string(content), "foreign.png") {
+		t.Errorf("expected gallery not to contain foreign.png")
+	}
+	names, err := readManifest(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "index.html,movie.mp4,photo.png" {
+		t.Errorf("expected the gallery in the manifest but got %v", names)
+	}
+
+	if err := writeGallery(folder, time.Now()); err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	content, err = os.ReadFile(path.Join(folder, galleryFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "2 file(s) picked") || strings.Contains(string(content), galleryFilename) {
+		t.Errorf("expected the gallery not to list itself")
+	}
+}
@@ -5,17 +5,22 @@ go 1.22
 toolchain go1.22.4
 
 require (
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/juju/gnuflag v1.0.0
+	github.com/pkg/sftp v1.13.6
 	github.com/rs/zerolog v1.33.0
+	golang.org/x/crypto v0.25.0
+	golang.org/x/net v0.27.0
+	golang.org/x/sys v0.22.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/coreos/go-systemd/v22 v22.5.0 // indirect
+	github.com/kr/fs v0.1.0 // indirect
 	github.com/kr/pretty v0.3.1 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/rogpeppe/go-internal v1.11.0 // indirect
-	golang.org/x/sys v0.22.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
 )
@@ -20,6 +20,11 @@ func adjustLogLevel(options ProgramOptions) {
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
 	}
 	if options.journalDLogging {
-		log.Logger = log.Output(journald.NewJournalDWriter())
+		useJournalD()
 	}
 }
+
+// useJournalD sends the log to journald.
+func useJournalD() {
+	log.Logger = log.Output(journald.NewJournalDWriter())
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/rs/zerolog/log"
+)
+
+// manifestFilename is the name of the manifest in the destination folder that
+// lists the files placed there by pick-files.
+const manifestFilename string = ".pick-files-manifest.json"
+
+type manifest struct {
+	Files []string `json:"files"`
+}
+
+// readManifest returns the names of the files placed into `folder` by previous
+// runs. The returned error wraps os.ErrNotExist if there is no manifest.
+func readManifest(folder string) ([]string, error) {
+	encoded, err := os.ReadFile(path.Join(folder, manifestFilename))
+	if err != nil {
+		return nil, err
+	}
+	return decodeManifest(encoded, folder)
+}
+
+// decodeManifest returns the names of the files listed in the manifest
+// `encoded` read from `folder`.
+func decodeManifest(encoded []byte, folder string) ([]string, error) {
+	var result manifest
+	err := json.Unmarshal(encoded, &result)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling manifest in %s: %s", folder, err.Error())
+	}
+	return result.Files, nil
+}
+
+// writeManifest writes the manifest into `folder` listing the files `names`.
+func writeManifest(folder string, names []string) error {
+	encoded, err := encodeManifest(names)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(path.Join(folder, manifestFilename), encoded, 0644)
+	if err != nil {
+		return fmt.Errorf("error writing manifest in %s: %s", folder, err.Error())
+	}
+	log.Debug().Msgf("wrote manifest into %s", folder)
+	return nil
+}
+
+// encodeManifest returns the manifest listing the files `names` once each
+// and in sorted order.
+func encodeManifest(names []string) ([]byte, error) {
+	var seen map[string]bool = map[string]bool{}
+	var result manifest = manifest{Files: []string{}}
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		result.Files = append(result.Files, name)
+	}
+	sort.Strings(result.Files)
+	encoded, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling manifest: %s", err.Error())
+	}
+	return encoded, nil
+}
+
+// removableEntries returns the names of the entries in `folder` that may be
+// removed, i.e. the files listed in the manifest that still exist. If
+// `forceClean` is true then all entries in `folder` other than the manifest
+// are returned.
+func removableEntries(folder string, forceClean bool) ([]string, error) {
+	var result []string = []string{}
+	if forceClean {
+		dirEntries, err := os.ReadDir(folder)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range dirEntries {
+			if entry.Name() == manifestFilename {
+				continue
+			}
+			result = append(result, entry.Name())
+		}
+		return result, nil
+	}
+	names, err := readManifest(folder)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Warn().Msgf("no manifest found in %s, not removing any files; use --force-clean to remove all files", folder)
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if !isValidManifestEntry(name) {
+			log.Warn().Msgf("ignoring invalid manifest entry %s", name)
+			continue
+		}
+		if _, err := os.Lstat(path.Join(folder, name)); err != nil {
+			log.Debug().Msgf("%s listed in manifest no longer exists", name)
+			continue
+		}
+		result = append(result, name)
+	}
+	return result, nil
+}
+
+// isValidManifestEntry returns true if the manifest entry `name` names a file
+// directly in the destination folder other than the manifest itself.
+func isValidManifestEntry(name string) bool {
+	return name != manifestFilename && name != "." && name != ".." && path.Base(name) == name
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestRemovableEntries(t *testing.T) {
+	var folder string = t.TempDir()
+	for _, name := range []string{"picked.jpg", "foreign.jpg"} {
+		if err := os.WriteFile(path.Join(folder, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(path.Join(folder, "sub"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := removableEntries(folder, false)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	if len(names) != 0 {
+		t.Errorf("expected no removable entries without manifest but got %v", names)
+	}
+
+	if err := writeManifest(folder, []string{"picked.jpg", "gone.jpg", "../escape.jpg"}); err != nil {
+		t.Fatal(err)
+	}
+	names, err = removableEntries(folder, false)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	if strings.Join(names, ",") != "picked.jpg" {
+		t.Errorf("expected picked.jpg but got %v", names)
+	}
+
+	names, err = removableEntries(folder, true)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	var expectedNames string = "foreign.jpg,picked.jpg,sub"
+	if strings.Join(names, ",") != expectedNames {
+		t.Errorf("expected %s but got %v", expectedNames, names)
+	}
+}
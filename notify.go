@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// webhookSecretVariable is the environment variable holding the secret used
+// to sign the webhook notifications.
+const webhookSecretVariable string = "PICK_FILES_WEBHOOK_SECRET"
+
+// webhookSignatureHeader is the header carrying the HMAC-SHA256 signature of
+// the notification body, as `sha256=` followed by the hex encoded signature.
+const webhookSignatureHeader string = "X-Pick-Files-Signature"
+
+// webhookAttempts is the number of times a notification is sent before
+// giving up.
+const webhookAttempts int = 4
+
+// webhookRetryDelay is the delay before the first retry; it doubles with
+// every further retry.
+var webhookRetryDelay time.Duration = 2 * time.Second
+
+// webhookClient is the client sending the notifications.
+var webhookClient *http.Client = &http.Client{Timeout: 30 * time.Second}
+
+// runSummary is the notification sent to the webhook after a run.
+type runSummary struct {
+	Profile     string    `json:"profile,omitempty"`
+	Started     time.Time `json:"started"`
+	Duration    float64   `json:"durationSeconds"`
+	DryRun      bool      `json:"dryRun"`
+	Success     bool      `json:"success"`
+	Destination string    `json:"destination"`
+	Picked      int       `json:"picked"`
+	Failed      int       `json:"failed"`
+	Files       []Pick    `json:"files"`
+	FailedFiles []string  `json:"failedFiles,omitempty"`
+	Errors      []string  `json:"errors,omitempty"`
+}
+
+// newRunSummary returns the summary of a run started at `started` which
+// picked `picks` and failed with `err` if not nil.
+func newRunSummary(options ProgramOptions, started time.Time, picks []Pick, err error) runSummary {
+	var destination string = options.Destination
+	if u, ok := remoteURL(options.Destination); ok {
+		destination = redactedURL(u).String()
+	}
+	var summary runSummary = runSummary{
+		Profile:     options.profile,
+		Started:     started.UTC(),
+		Duration:    time.Since(started).Seconds(),
+		DryRun:      options.dryRun,
+		Success:     err == nil,
+		Destination: destination,
+		Picked:      len(picks),
+		Files:       picks,
+	}
+	if summary.Files == nil {
+		summary.Files = []Pick{}
+	}
+	var verificationError *VerificationError
+	if errors.As(err, &verificationError) {
+		summary.Failed = len(verificationError.Files)
+		for _, file := range verificationError.Files {
+			summary.FailedFiles = append(summary.FailedFiles, file.Path)
+		}
+	}
+	if err != nil {
+		summary.Errors = []string{err.Error()}
+	}
+	return summary
+}
+
+// signWebhookBody returns the value of the signature header for `body`.
+func signWebhookBody(body []byte, secret string) string {
+	var mac = hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// postWebhook sends `body` to `webhook` once. The returned bool is true if
+// sending again might succeed.
+func postWebhook(webhook string, body []byte, secret string) (bool, error) {
+	request, err := http.NewRequest(http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "pick-files/"+Version)
+	if secret != "" {
+		request.Header.Set(webhookSignatureHeader, signWebhookBody(body, secret))
+	}
+	response, err := webhookClient.Do(request)
+	if err != nil {
+		return true, err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("webhook answered %s", response.Status)
+	return response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests, err
+}
+
+// notifyWebhook posts `summary` to `webhook`, retrying with increasing
+// delays if the webhook cannot be reached or fails temporarily. The body is
+// signed with the secret in the environment variable webhookSecretVariable if
+// it is set.
+func notifyWebhook(webhook string, summary runSummary) error {
+	u, err := url.Parse(webhook)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("invalid webhook URL %s", webhook)
+	}
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	var secret string = os.Getenv(webhookSecretVariable)
+	var delay time.Duration = webhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		retry, err := postWebhook(webhook, body, secret)
+		if err == nil {
+			log.Debug().Msgf("notified webhook %s", redactedURL(u))
+			return nil
+		}
+		if !retry || attempt == webhookAttempts {
+			return fmt.Errorf("cannot notify webhook %s: %w", redactedURL(u), err)
+		}
+		log.Warn().Msgf("cannot notify webhook %s, retrying in %s: %s", redactedURL(u), delay, err.Error())
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"time"
+)
+
+type OutputFormat int
+
+const (
+	NOOUTPUT OutputFormat = iota
+	JSONOUTPUT
+	NDJSONOUTPUT
+	PATHSOUTPUT
+	PATHS0OUTPUT
+)
+
+func (f *OutputFormat) String() string {
+	switch *f {
+	case NOOUTPUT:
+		return ""
+	case JSONOUTPUT:
+		return "json"
+	case NDJSONOUTPUT:
+		return "ndjson"
+	case PATHSOUTPUT:
+		return "paths"
+	case PATHS0OUTPUT:
+		return "paths0"
+	}
+	return "unknown"
+}
+
+func (f *OutputFormat) Set(s string) error {
+	switch s {
+	case "":
+		*f = NOOUTPUT
+	case "json":
+		*f = JSONOUTPUT
+	case "ndjson":
+		*f = NDJSONOUTPUT
+	case "paths":
+		*f = PATHSOUTPUT
+	case "paths0":
+		*f = PATHS0OUTPUT
+	default:
+		return fmt.Errorf("unknown output format %s", s)
+	}
+	return nil
+}
+
+func (f *OutputFormat) UnmarshalText(bs []byte) error {
+	return f.Set(string(bs))
+}
+
+func (f OutputFormat) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// newPicks returns the Pick records of the picked files where `destinations`
+// holds the destination paths keyed by source path.
+func newPicks(pickedFiles Files, destinations map[string]string) []Pick {
+	var picks []Pick = []Pick{}
+	for _, file := range pickedFiles {
+		picks = append(picks, Pick{
+			Source:             file.Path,
+			Destination:        destinations[file.Path],
+			Md5sum:             file.Md5sum,
+			PreviousLastPicked: file.LastPicked,
+		})
+	}
+	return picks
+}
+
+// plannedDestinations returns the destination paths the picked files would be
+// copied to keyed by their source path. It is used with --dry-run where no
+// files are copied and therefore assumes that the destination does not hold
+// any files yet unless files are appended.
+func plannedDestinations(options ProgramOptions, pickedFiles Files) map[string]string {
+	var folder destinationFolder = localFolder(options.Destination)
+	if u, ok := remoteURL(options.Destination); ok {
+		folder = remoteDestination{folder: newRemoteFolder(u)}
+	} else if options.DestinationOption == ROTATE {
+		folder = localFolder(path.Join(options.Destination, time.Now().Format(options.BatchNameFormat)))
+	}
+	names, err := assignDestinationNames(pickedFiles, func(name string) bool {
+		if options.DestinationOption != APPEND || options.DestinationFormat != DIRECTORY {
+			return false
+		}
+		return folder.Exists(name)
+	}, true)
+	var destinations map[string]string = map[string]string{}
+	if err != nil {
+		return destinations
+	}
+	for i, file := range pickedFiles {
+		if options.DestinationFormat != DIRECTORY {
+			destinations[file.Path] = archiveMemberPath(path.Clean(options.Destination), names[i])
+		} else {
+			destinations[file.Path] = folder.Path(names[i])
+		}
+	}
+	return destinations
+}
+
+// writePicks writes the picks in format `format` to `w`. The paths formats
+// write the destination paths of the picks, or their source paths if the picks
+// were not copied, separated by newlines (paths) or NUL characters (paths0).
+func writePicks(w io.Writer, format OutputFormat, picks []Pick) error {
+	switch format {
+	case JSONOUTPUT:
+		encoded, err := json.MarshalIndent(picks, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(encoded))
+		return err
+	case NDJSONOUTPUT:
+		encoder := json.NewEncoder(w)
+		for _, pick := range picks {
+			err := encoder.Encode(pick)
+			if err != nil {
+				return err
+			}
+		}
+	case PATHSOUTPUT, PATHS0OUTPUT:
+		var separator string = "\n"
+		if format == PATHS0OUTPUT {
+			separator = "\x00"
+		}
+		for _, pick := range picks {
+			var p string = pick.Destination
+			if p == "" {
+				p = pick.Source
+			}
+			_, err := io.WriteString(w, p+separator)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
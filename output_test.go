@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestWritePicks(t *testing.T) {
+	var lastPicked time.Time = time.Date(2026, 10, 1, 11, 0, 0, 0, time.UTC)
+	var picks []Pick = newPicks(Files{
+		File{Name: "a.jpg", Path: "/photos/a.jpg", Md5sum: "a", LastPicked: lastPicked},
+		File{Name: "b.jpg", Path: "/photos/b.jpg", Md5sum: "b"},
+	}, map[string]string{"/photos/a.jpg": "/output/a.jpg"})
+
+	var result bytes.Buffer
+	if err := writePicks(&result, PATHS0OUTPUT, picks); err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	if result.String() != "/output/a.jpg\x00/photos/b.jpg\x00" {
+		t.Errorf("unexpected paths0 output %q", result.String())
+	}
+
+	result.Reset()
+	if err := writePicks(&result, NDJSONOUTPUT, picks); err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	var decoded Pick
+	if err := json.NewDecoder(&result).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != picks[0] {
+		t.Errorf("expected %v but got %v", picks[0], decoded)
+	}
+
+	result.Reset()
+	if err := writePicks(&result, JSONOUTPUT, picks); err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	var decodedPicks []Pick
+	if err := json.Unmarshal(result.Bytes(), &decodedPicks); err != nil {
+		t.Fatal(err)
+	}
+	if len(decodedPicks) != 2 || decodedPicks[1].Destination != "" || !decodedPicks[0].PreviousLastPicked.Equal(lastPicked) {
+		t.Errorf("unexpected json output %s", result.String())
+	}
+}
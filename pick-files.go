@@ -10,8 +10,10 @@ import (
 	"os"
 	"path"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -21,6 +23,20 @@ var Version = "unknown"
 
 var ErrDestinationFileAlreadyExists = errors.New("destination file already exists")
 
+// VerificationError is returned if copied files still differed from their
+// source after all copy attempts.
+type VerificationError struct {
+	Files Files
+}
+
+func (e *VerificationError) Error() string {
+	var paths []string = []string{}
+	for _, file := range e.Files {
+		paths = append(paths, file.Path)
+	}
+	return fmt.Sprintf("verification failed for %d file(s): %s", len(e.Files), strings.Join(paths, ", "))
+}
+
 type DatabaseStatistics struct {
 	dbSize           int64
 	NumberEntries    int
@@ -40,6 +56,13 @@ func (f DatabaseStatistics) String() string {
 const dbSchema int = 1
 const dbFilename string = "pick-files-db.json"
 
+// pickHistoryLength is the number of picks of a file kept in its pick history.
+const pickHistoryLength int = 10
+
+// favouriteWeight is how many times more likely favourites are picked than
+// other files.
+const favouriteWeight int = 2
+
 type db struct {
 	Schema int   `json:"schema"`
 	Files  Files `json:"files"`
@@ -93,6 +116,10 @@ const (
 	PANIC = iota
 	APPEND
 	DELETE
+	ATOMIC
+	ROTATE
+	SYNC
+	TRASH
 	UNSET
 )
 
@@ -106,6 +133,14 @@ func (o *DestinationOption) String() string {
 		return "append"
 	case DELETE:
 		return "delete"
+	case ATOMIC:
+		return "atomic"
+	case ROTATE:
+		return "rotate"
+	case SYNC:
+		return "sync"
+	case TRASH:
+		return "trash"
 	}
 	return "unknown"
 }
@@ -118,6 +153,14 @@ func (o *DestinationOption) Set(s string) error {
 		*o = APPEND
 	case "delete":
 		*o = DELETE
+	case "atomic":
+		*o = ATOMIC
+	case "rotate":
+		*o = ROTATE
+	case "sync":
+		*o = SYNC
+	case "trash":
+		*o = TRASH
 	default:
 		return fmt.Errorf("unknown options %s", s)
 	}
@@ -126,39 +169,129 @@ func (o *DestinationOption) Set(s string) error {
 
 func (o *DestinationOption) UnmarshalText(bs []byte) error {
 	switch string(bs) {
+	case "unset":
+		*o = UNSET
 	case "panic":
 		*o = PANIC
 	case "append":
 		*o = APPEND
 	case "delete":
 		*o = DELETE
+	case "atomic":
+		*o = ATOMIC
+	case "rotate":
+		*o = ROTATE
+	case "sync":
+		*o = SYNC
+	case "trash":
+		*o = TRASH
 	default:
 		return fmt.Errorf("unknown options %s", string(bs))
 	}
 	return nil
 }
 
+func (o DestinationOption) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+type DestinationFormat int
+
+const (
+	DIRECTORY DestinationFormat = iota
+	ZIP
+	TAR
+	TARGZ
+)
+
+func (f *DestinationFormat) String() string {
+	switch *f {
+	case DIRECTORY:
+		return "dir"
+	case ZIP:
+		return "zip"
+	case TAR:
+		return "tar"
+	case TARGZ:
+		return "tar.gz"
+	}
+	return "unknown"
+}
+
+func (f *DestinationFormat) Set(s string) error {
+	switch s {
+	case "dir":
+		*f = DIRECTORY
+	case "zip":
+		*f = ZIP
+	case "tar":
+		*f = TAR
+	case "tar.gz", "tgz":
+		*f = TARGZ
+	default:
+		return fmt.Errorf("unknown destination format %s", s)
+	}
+	return nil
+}
+
+func (f *DestinationFormat) UnmarshalText(bs []byte) error {
+	return f.Set(string(bs))
+}
+
+func (f DestinationFormat) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
 type ProgramOptions struct {
+	BatchNameFormat         string `yaml:"batch-name-format"`
 	blockSelectionDuration  time.Duration
 	BlockSelectionString    string `yaml:"block-selection"`
+	command                 string
+	commandLine             *ProgramOptions
 	configurationFile       string
+	CopyJobs                int `yaml:"copy-jobs"`
 	dbExpirationAge         time.Duration
 	debugRequested          bool
 	Destination             string            `yaml:"destination"`
+	DestinationFormat       DestinationFormat `yaml:"destination-format"`
 	DestinationOption       DestinationOption `yaml:"destination-option"`
 	dumpConfiguration       bool
+	Email                   *EmailSettings `yaml:"email,omitempty"`
 	dryRun                  bool
+	FilesFrom               string  `yaml:"files-from"`
 	Folders                 Folders `yaml:"folder"`
+	ForceClean              bool    `yaml:"force-clean"`
 	helpRequested           bool
+	HTMLGallery             bool `yaml:"html-gallery"`
 	journalDLogging         bool
-	NumberOfFiles           int `yaml:"number"`
+	KeepBatches             int `yaml:"keep-batches"`
+	listen                  string
+	NotifyWebhook           string             `yaml:"notify-webhook"`
+	NumberOfFiles           int                `yaml:"number"`
+	Output                  OutputFormat       `yaml:"output"`
+	Playlist                string             `yaml:"playlist"`
+	PlaylistOnly            bool               `yaml:"playlist-only"`
+	PlaylistRelative        bool               `yaml:"playlist-relative"`
+	Preserve                PreserveAttributes `yaml:"preserve"`
 	printDatabase           string
 	printDatabaseFormat     DumpFormat
 	printDatabaseStatistics bool
 	printVersion            bool
+	profile                 string
+	Profiles                map[string]Profile `yaml:"profiles,omitempty"`
 	resetDatabase           bool
+	schedule                string
+	SkipScan                bool     `yaml:"skip-scan"`
 	Suffixes                Suffixes `yaml:"suffix"`
+	systemdAction           string
 	verboseRequested        bool
+	Verify                  bool `yaml:"verify"`
+	VerifyRetries           int  `yaml:"verify-retries"`
+}
+
+// hasSources returns true if any source of candidate files was specified.
+func (o ProgramOptions) hasSources() bool {
+	return len(o.Folders) > 0 || o.FilesFrom != ""
 }
 
 func (o ProgramOptions) String() string {
@@ -169,14 +302,14 @@ func (o ProgramOptions) String() string {
 
 // convertDurationString converts a string into a duration with additional
 // units.
-func convertDurationString(durationString string) time.Duration {
+func convertDurationString(durationString string) (time.Duration, error) {
 	var daysRegex *regexp.Regexp = regexp.MustCompile("^([0-9]+)d$")
 	var weeksRegex *regexp.Regexp = regexp.MustCompile("^([0-9]+)w$")
 	if daysRegex.MatchString(durationString) {
 		dayString := daysRegex.FindStringSubmatch(durationString)
 		days, err := strconv.ParseInt(dayString[1], 10, 64)
 		if err != nil {
-			log.Fatal().Msgf("error parsing duration %s: %s", durationString, err.Error())
+			return 0, fmt.Errorf("error parsing duration %s: %w", durationString, err)
 		}
 		durationString = fmt.Sprintf("%dh", days*24)
 	}
@@ -184,52 +317,76 @@ func convertDurationString(durationString string) time.Duration {
 		weekString := weeksRegex.FindStringSubmatch(durationString)
 		weeks, err := strconv.ParseInt(weekString[1], 10, 64)
 		if err != nil {
-			log.Fatal().Msgf("error parsing duration %s: %s", durationString, err.Error())
+			return 0, fmt.Errorf("error parsing duration %s: %w", durationString, err)
 		}
 		durationString = fmt.Sprintf("%dh", weeks*24*7)
 	}
 	var err error
 	duration, err := time.ParseDuration(durationString)
 	if err != nil {
-		log.Fatal().Msgf("error parsing duration %s: %s", durationString, err.Error())
+		return 0, fmt.Errorf("error parsing duration %s: %w", durationString, err)
+	}
+	return duration, nil
+}
+
+// md5sumFile returns the hex encoded md5 sum of the content of the file at
+// `filename`.
+func md5sumFile(filename string) (string, error) {
+	source, name := sourceOf(filename)
+	file, _, err := openSourceFile(source, name)
+	if err != nil {
+		return "", err
 	}
-	return duration
+	defer file.Close()
+	return md5sumReader(file)
+}
+
+// md5sumReader returns the hex encoded md5 sum of the content read from
+// `reader`.
+func md5sumReader(reader io.Reader) (string, error) {
+	hash := md5.New()
+	_, err := io.Copy(hash, reader)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// newFileFromPath returns a new File for the file at `filename` with its md5
+// sum computed.
+func newFileFromPath(filename string) (File, error) {
+	source, name := sourceOf(filename)
+	return newFileFromSource(source, name)
 }
 
 // getFilesFromFolders recursively reads all files in a list of folders and returns a list
 // of files.
-func getFilesFromFolders(folders []string) Files {
+func getFilesFromFolders(folders []string) (Files, error) {
 	var files = Files{}
 	for _, folder := range folders {
-		log.Debug().Msgf("reading folder %s", folder)
-		dirEntries, err := os.ReadDir(folder)
-		if err != nil {
-			log.Fatal().Msg(err.Error())
+		if u, ok := remoteURL(folder); ok {
+			log.Debug().Msgf("reading remote folder %s", redactedURL(u))
+			remoteFiles, err := getFilesFromSource(newRemoteFolder(u))
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, remoteFiles...)
+			continue
 		}
-		for _, entry := range dirEntries {
-			if entry.IsDir() {
-				files = append(files, getFilesFromFolders([]string{path.Join(folder, entry.Name())})...)
-			} else {
-				file, err := os.Open(path.Join(folder, entry.Name()))
-				if err != nil {
-					log.Warn().Msg(err.Error())
-					return Files{}
-				}
-				hash := md5.New()
-				_, err = io.Copy(hash, file)
-				if err != nil {
-					log.Warn().Msg(err.Error())
-					return Files{}
-				}
-				newFile := File{
-					Name:     entry.Name(),
-					Path:     path.Join(folder, entry.Name()),
-					Md5sum:   hex.EncodeToString(hash.Sum(nil)),
-					LastSeen: time.Now().UTC(),
-				}
-				files = append(files, newFile)
+		if info, err := os.Stat(folder); err == nil && info.Mode().IsRegular() {
+			archiveFiles, err := getFilesFromArchive(folder)
+			if err != nil {
+				return nil, err
 			}
+			files = append(files, archiveFiles...)
+			continue
 		}
+		log.Debug().Msgf("reading folder %s", folder)
+		sourceFiles, err := getFilesFromSource(newOSSource(folder))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, sourceFiles...)
 	}
 	var filenamesFound map[string]string = map[string]string{}
 	for _, file := range files {
@@ -240,46 +397,414 @@ func getFilesFromFolders(folders []string) Files {
 		}
 	}
 	log.Debug().Msgf("found %d files in folder(s) %s", len(files), strings.Join(folders, ","))
-	return files
+	return files, nil
 }
 
 // copyFile copies the files `src` to file `dst` and returns the number of bytes
-// copied and potentially an error.
-func copyFile(src, dst string) (int64, error) {
+// copied and potentially an error. The attributes selected in `preserve` are
+// carried over from `src` to `dst`.
+func copyFile(src, dst string, preserve PreserveAttributes) (int64, error) {
+	source, name := sourceOf(src)
+	return copyFileFromSource(source, name, dst, preserve)
+}
+
+// copyFileFromSource copies the file `name` in `source` to file `dst` and
+// returns the number of bytes copied and potentially an error. Extended
+// attributes can only be preserved for files in the local file system.
+func copyFileFromSource(source Source, name, dst string, preserve PreserveAttributes) (int64, error) {
 	_, err := os.Stat(dst)
 	if err == nil {
 		return 0, ErrDestinationFileAlreadyExists
 	}
 
-	sourceFileStat, err := os.Stat(src)
+	var src string = source.Path(name)
+	sourceFile, sourceFileStat, err := openSourceFile(source, name)
 	if err != nil {
-		log.Fatal().Msgf("source file %s does not exist", src)
+		return 0, err
+	}
+	defer sourceFile.Close()
+
+	destination, err := os.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+	nBytes, err := io.Copy(destination, sourceFile)
+	if err != nil {
+		destination.Close()
+		return nBytes, err
+	}
+	err = destination.Close()
+	if err != nil {
+		return nBytes, err
+	}
+	log.Debug().Msgf("copied %s to %s", src, dst)
+	if _, ok := source.(*osSource); !ok {
+		preserve.Xattrs = false
 	}
+	return nBytes, preserveAttributes(src, dst, sourceFileStat, preserve)
+}
 
-	if !sourceFileStat.Mode().IsRegular() {
-		log.Fatal().Msgf("%s is not a regular file", src)
+// preserveAttributes carries the attributes selected in `preserve` over from
+// `src` to `dst`. The times are set last since changing the other attributes
+// might otherwise update them again.
+func preserveAttributes(src, dst string, srcInfo os.FileInfo, preserve PreserveAttributes) error {
+	if preserve.Mode {
+		err := os.Chmod(dst, srcInfo.Mode().Perm())
+		if err != nil {
+			return fmt.Errorf("cannot preserve mode of %s: %w", src, err)
+		}
+	}
+	if preserve.Xattrs {
+		err := copyXattrs(src, dst)
+		if err != nil {
+			return fmt.Errorf("cannot preserve extended attributes of %s: %w", src, err)
+		}
+	}
+	if preserve.Times {
+		err := os.Chtimes(dst, accessTime(srcInfo), srcInfo.ModTime())
+		if err != nil {
+			return fmt.Errorf("cannot preserve times of %s: %w", src, err)
+		}
+	}
+	return nil
+}
+
+// assignDestinationNames returns the filenames for the picked files where
+// `taken` reports whether a filename is already in use at the destination. The
+// names are assigned in the order of `pickedFiles` so that the naming does not
+// depend on the order in which the files are eventually copied. If `rename` is
+// true then filename collisions are resolved by appending a counter to the
+// filename, otherwise a collision is an error.
+func assignDestinationNames(pickedFiles Files, taken func(string) bool, rename bool) ([]string, error) {
+	var suffixRegex = regexp.MustCompile("^(.*)[.]([^.]*)$")
+	var names []string = []string{}
+	var assigned map[string]bool = map[string]bool{}
+	for _, file := range pickedFiles {
+		var filename []string = suffixRegex.FindStringSubmatch(file.Name)
+		if filename == nil {
+			return names, fmt.Errorf("could not strip suffix from filename %s", file.Name)
+		}
+		var combinedFilename string
+		for counter := 0; ; counter++ {
+			if counter == 0 {
+				combinedFilename = file.Name
+			} else {
+				combinedFilename = fmt.Sprintf("%s-%d.%s", filename[1], counter, filename[2])
+			}
+			if !taken(combinedFilename) && !assigned[combinedFilename] {
+				break
+			}
+			if !rename {
+				return names, fmt.Errorf("error copying %s to %s (%s)", file.Path, combinedFilename, ErrDestinationFileAlreadyExists.Error())
+			}
+			// Check for filename collision.
+			log.Debug().Msgf("filename collision: %s already exists", combinedFilename)
+		}
+		assigned[combinedFilename] = true
+		names = append(names, combinedFilename)
 	}
+	return names, nil
+}
+
+// destinationFolder is a folder the picked files are copied into.
+type destinationFolder interface {
+	// Exists returns true if the folder holds an entry `name`.
+	Exists(name string) bool
+	// CopyFile copies `file` into the folder as `name`.
+	CopyFile(file File, name string, preserve PreserveAttributes) error
+	// Md5sum returns the md5 sum of the file `name` in the folder.
+	Md5sum(name string) (string, error)
+	// Remove removes the file `name` from the folder.
+	Remove(name string) error
+	// Path returns the path of the file `name` in the folder.
+	Path(name string) string
+}
+
+// localFolder is a destination folder in the local file system.
+type localFolder string
+
+func (f localFolder) Exists(name string) bool {
+	_, err := os.Lstat(f.Path(name))
+	return err == nil
+}
+
+func (f localFolder) CopyFile(file File, name string, preserve PreserveAttributes) error {
+	_, err := copyFile(file.Path, f.Path(name), preserve)
+	return err
+}
+
+func (f localFolder) Md5sum(name string) (string, error) {
+	return md5sumFile(f.Path(name))
+}
+
+func (f localFolder) Remove(name string) error {
+	return os.Remove(f.Path(name))
+}
+
+func (f localFolder) Path(name string) string {
+	return path.Join(string(f), name)
+}
 
-	source, err := os.Open(src)
+// copyPickedFiles copies the picked files into the folder `destination` and
+// returns the names of the copied files keyed by their source path. See
+// copyPickedFilesInto.
+func copyPickedFiles(destination string, pickedFiles Files, rename bool, options ProgramOptions) (map[string]string, error) {
+	return copyPickedFilesInto(localFolder(destination), pickedFiles, rename, options)
+}
+
+// copyPickedFilesInto copies the picked files into `folder` and returns the
+// names of the copied files keyed by their source path. At most
+// `options.CopyJobs` files are copied concurrently. If `rename` is true then
+// filename collisions are resolved by appending a counter to the filename,
+// otherwise a collision is an error. If `options.Verify` is set then copies
+// that do not match their source are retried and eventually removed; those
+// files are reported in a VerificationError after all other files were
+// copied.
+func copyPickedFilesInto(folder destinationFolder, pickedFiles Files, rename bool, options ProgramOptions) (map[string]string, error) {
+	var placed map[string]string = map[string]string{}
+	names, err := assignDestinationNames(pickedFiles, folder.Exists, rename)
 	if err != nil {
-		return 0, err
+		return placed, err
 	}
-	defer source.Close()
 
-	destination, err := os.Create(dst)
+	var jobs int = max(options.CopyJobs, 1)
+	var copyErrors []error = make([]error, len(pickedFiles))
+	var verifyErrors []error = make([]error, len(pickedFiles))
+	var semaphore = make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	log.Debug().Msgf("copying %d file(s) with %d job(s)", len(pickedFiles), jobs)
+	for i, file := range pickedFiles {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, file File) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			log.Debug().Msgf("attempting to copy %s -> %s", file.Path, names[i])
+			err := folder.CopyFile(file, names[i], options.Preserve)
+			if err != nil {
+				copyErrors[i] = fmt.Errorf("error copying %s to %s (%s)", file.Path, folder.Path(""), err.Error())
+				return
+			}
+			if options.Verify {
+				verifyErrors[i] = verifyCopy(folder, file, names[i], options)
+			}
+		}(i, file)
+	}
+	wg.Wait()
+
+	var failed Files = Files{}
+	var errs []error = []error{}
+	for i, file := range pickedFiles {
+		switch {
+		case copyErrors[i] != nil:
+			log.Error().Msg(copyErrors[i].Error())
+			errs = append(errs, copyErrors[i])
+		case verifyErrors[i] != nil:
+			log.Error().Msg(verifyErrors[i].Error())
+			failed = append(failed, file)
+		default:
+			log.Debug().Msgf("successfully copied %s", names[i])
+			placed[file.Path] = names[i]
+		}
+	}
+	if len(errs) > 0 {
+		return placed, errors.Join(errs...)
+	}
+	if len(failed) > 0 {
+		return placed, &VerificationError{Files: failed}
+	}
+	return placed, nil
+}
+
+// placedNames returns the destination names of the placed files.
+func placedNames(placed map[string]string) []string {
+	var names []string = []string{}
+	for _, name := range placed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// placedPaths returns the destination paths in `folder` of the placed files
+// keyed by their source path.
+func placedPaths(folder string, placed map[string]string) map[string]string {
+	var paths map[string]string = map[string]string{}
+	for source, name := range placed {
+		paths[source] = path.Join(folder, name)
+	}
+	return paths
+}
+
+// verifyCopy compares the md5 sum of the copy `name` in `folder` with the md5
+// sum of `file` and copies the file again on a mismatch, at most
+// `options.VerifyRetries` times. If the copy still differs then it is removed
+// and an error is returned.
+func verifyCopy(folder destinationFolder, file File, name string, options ProgramOptions) error {
+	var dst string = folder.Path(name)
+	for attempt := 0; ; attempt++ {
+		md5sum, err := folder.Md5sum(name)
+		if err == nil && md5sum == file.Md5sum {
+			log.Debug().Msgf("verified %s", dst)
+			return nil
+		}
+		if err == nil {
+			err = fmt.Errorf("md5 sum %s does not match %s", md5sum, file.Md5sum)
+		}
+		log.Warn().Msgf("verification of %s failed: %s", dst, err.Error())
+		folder.Remove(name)
+		if attempt >= options.VerifyRetries {
+			return fmt.Errorf("giving up on copying %s to %s after %d attempt(s)", file.Path, dst, attempt+1)
+		}
+		err = folder.CopyFile(file, name, options.Preserve)
+		if err != nil {
+			return fmt.Errorf("error copying %s to %s (%s)", file.Path, dst, err.Error())
+		}
+	}
+}
+
+// syncPickedFiles makes the destination folder hold exactly the picked files
+// while touching as few files as possible. Files placed by previous runs are
+// compared by md5 sum with the picked files; stale files are removed and only
+// picked files not present yet are copied. Files not listed in the manifest
+// are left alone unless `options.ForceClean` is set, and sub-folders of the
+// destination folder are always left alone. The destination paths of the
+// picked files are returned keyed by their source path.
+func syncPickedFiles(options ProgramOptions, pickedFiles Files) (map[string]string, error) {
+	err := os.MkdirAll(options.Destination, os.ModePerm)
 	if err != nil {
-		return 0, err
+		return nil, fmt.Errorf("error creating destination folder %s: %s", options.Destination, err.Error())
 	}
-	defer destination.Close()
-	nBytes, err := io.Copy(destination, source)
-	log.Debug().Msgf("copied %s to %s", src, dst)
-	return nBytes, err
+	names, err := removableEntries(options.Destination, options.ForceClean)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read destination folder %s: %s", options.Destination, err.Error())
+	}
+
+	var wanted map[string]bool = map[string]bool{}
+	for _, file := range pickedFiles {
+		wanted[file.Md5sum] = true
+	}
+	var present map[string]bool = map[string]bool{}
+	var kept map[string]string = map[string]string{}
+	for _, name := range names {
+		var existing string = path.Join(options.Destination, name)
+		info, err := os.Lstat(existing)
+		if err != nil {
+			return nil, err
+		}
+		if name == manifestFilename || !info.Mode().IsRegular() {
+			log.Debug().Msgf("skipping %s", existing)
+			continue
+		}
+		md5sum, err := md5sumFile(existing)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s: %s", existing, err.Error())
+		}
+		if wanted[md5sum] && !present[md5sum] {
+			log.Debug().Msgf("keeping %s", existing)
+			present[md5sum] = true
+			kept[md5sum] = name
+			continue
+		}
+		log.Debug().Msgf("removing stale %s", existing)
+		err = os.Remove(existing)
+		if err != nil {
+			return nil, fmt.Errorf("cannot remove %s: %s", existing, err.Error())
+		}
+	}
+
+	var newFiles Files = Files{}
+	for _, file := range pickedFiles {
+		if present[file.Md5sum] {
+			continue
+		}
+		present[file.Md5sum] = true
+		newFiles = append(newFiles, file)
+	}
+	log.Info().Msgf("kept %d and copying %d file(s) into %s", len(pickedFiles)-len(newFiles), len(newFiles), options.Destination)
+	placed, err := copyPickedFiles(options.Destination, newFiles, true, options)
+	var verificationError *VerificationError
+	if err != nil && !errors.As(err, &verificationError) {
+		return nil, err
+	}
+	var manifestNames []string = placedNames(placed)
+	for _, file := range pickedFiles {
+		if name, ok := kept[file.Md5sum]; ok {
+			placed[file.Path] = name
+			manifestNames = append(manifestNames, name)
+		}
+	}
+	manifestErr := writeManifest(options.Destination, manifestNames)
+	if manifestErr != nil {
+		return nil, manifestErr
+	}
+	return placedPaths(options.Destination, placed), err
+}
+
+// copyFilesAtomically copies the picked files into a staging folder next to
+// the destination folder and only swaps the staging folder into place once all
+// files were copied and verified successfully; otherwise the destination folder
+// is left untouched and no destination paths are returned. The previous
+// destination folder is kept as `<destination>.prev`. The destination paths of
+// the picked files are returned keyed by their source path.
+func copyFilesAtomically(options ProgramOptions, pickedFiles Files) (map[string]string, error) {
+	var destination string = path.Clean(options.Destination)
+	var staging string = destination + ".staging"
+	var previous string = destination + ".prev"
+
+	log.Debug().Msgf("copying files into staging folder %s", staging)
+	err := os.RemoveAll(staging)
+	if err != nil {
+		return nil, fmt.Errorf("cannot remove old staging folder %s: %w", staging, err)
+	}
+	err = os.MkdirAll(staging, os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("error creating staging folder %s: %w", staging, err)
+	}
+	placed, err := copyPickedFiles(staging, pickedFiles, true, options)
+	if err == nil {
+		err = writeManifest(staging, placedNames(placed))
+	}
+	if err != nil {
+		os.RemoveAll(staging)
+		return nil, fmt.Errorf("%w; leaving destination folder %s untouched", err, destination)
+	}
+
+	var keptPrevious bool = false
+	_, err = os.Stat(destination)
+	if err == nil {
+		log.Info().Msgf("keeping previous destination folder as %s", previous)
+		err = os.RemoveAll(previous)
+		if err != nil {
+			return nil, fmt.Errorf("cannot remove %s: %w", previous, err)
+		}
+		err = os.Rename(destination, previous)
+		if err != nil {
+			return nil, fmt.Errorf("cannot move %s to %s: %w", destination, previous, err)
+		}
+		keptPrevious = true
+	}
+	err = os.Rename(staging, destination)
+	if err != nil {
+		if keptPrevious {
+			// Put the previous destination folder back so that the
+			// destination is never missing.
+			restoreErr := os.Rename(previous, destination)
+			if restoreErr != nil {
+				log.Error().Msgf("cannot move %s back to %s: %s", previous, destination, restoreErr.Error())
+			}
+		}
+		return nil, fmt.Errorf("cannot move %s to %s: %w", staging, destination, err)
+	}
+	log.Debug().Msgf("swapped staging folder into %s", destination)
+	return placedPaths(destination, placed), nil
 }
 
 // pickFiles randomly picks files and copies those to the destination folder.
 // The function updates the timestampes on the chosen files and returns the
-// updated list of Files.
-func pickFiles(options ProgramOptions, files Files) Files {
+// updated list of Files and the picks. Files that failed verification are not
+// marked as picked and are reported in the returned error.
+func pickFiles(options ProgramOptions, files Files) (Files, []Pick, error) {
 	var suffixRegex = ".*$"
 
 	if len(options.Suffixes) > 0 {
@@ -298,6 +823,17 @@ func pickFiles(options ProgramOptions, files Files) Files {
 		}
 	}
 
+	// Down-select banned files.
+	temp = eligibleFiles
+	eligibleFiles = Files{}
+	for _, file := range temp {
+		if file.Banned {
+			log.Debug().Msgf("%s is banned; skipping", file.Path)
+			continue
+		}
+		eligibleFiles = append(eligibleFiles, file)
+	}
+
 	// Down-select based on block duration.
 	if options.blockSelectionDuration > 0 {
 		log.Debug().Msg("filter files based on block selection duration")
@@ -323,88 +859,228 @@ func pickFiles(options ProgramOptions, files Files) Files {
 			log.Warn().Msg("ran out of eligible files")
 			break
 		}
-		j := rand.Intn(len(eligibleFiles))
+		var totalWeight int = 0
+		for _, file := range eligibleFiles {
+			totalWeight += pickWeight(file)
+		}
+		var r int = rand.Intn(totalWeight)
+		var j int = 0
+		for r >= pickWeight(eligibleFiles[j]) {
+			r -= pickWeight(eligibleFiles[j])
+			j++
+		}
 		log.Debug().Msgf("picked file %s", eligibleFiles[j])
 		pickedFiles = append(pickedFiles, eligibleFiles[j])
 		eligibleFiles = append(eligibleFiles[:j], eligibleFiles[j+1:]...)
 	}
 	log.Debug().Msgf("considered %d files and picked %d", len(files), len(pickedFiles))
 
+	var err error
+	var picks []Pick = []Pick{}
+	var destinations map[string]string = map[string]string{}
 	if !options.dryRun {
 		if len(pickedFiles) > 0 {
-			_, err := os.Stat(options.Destination)
-			if err == nil {
-				switch options.DestinationOption {
-				case DELETE:
-					log.Info().Msgf("deleting files in destination folder %s", options.Destination)
-					dirEntries, err := os.ReadDir(options.Destination)
-					if err != nil {
-						log.Fatal().Msg("unable to read destination folder")
-					}
-					for _, entry := range dirEntries {
-						log.Debug().Msgf("removing %s", path.Join(options.Destination, entry.Name()))
-						err = os.Remove(path.Join(options.Destination, entry.Name()))
-						if err != nil {
-							log.Fatal().Msgf("cannot remove %s: %s", entry.Name(), err.Error())
-						}
-					}
-				case APPEND:
-					log.Debug().Msg("appending files to existing destination")
-				default:
-					log.Fatal().Msg("destination folder already exists, aborting")
-				}
+			var failed Files = Files{}
+			if !options.PlaylistOnly {
+				destinations, err = placePickedFiles(options, pickedFiles)
+			} else {
+				log.Info().Msg("playlist only, skipping copying of files")
 			}
-			err = os.MkdirAll(options.Destination, os.ModePerm)
-			if err != nil {
-				log.Fatal().Msgf("error creating destination folder %s: %s", options.Destination, err.Error())
+			// Files that failed verification are not picked; if no files were
+			// placed at all then the run failed.
+			var verificationError *VerificationError
+			if errors.As(err, &verificationError) && destinations != nil {
+				failed = verificationError.Files
+			} else if err != nil {
+				return files, nil, err
 			}
-			var suffixRegex = regexp.MustCompile("^(.*)[.]([^.]*)$")
-			for _, file := range pickedFiles {
-				var filename []string = suffixRegex.FindStringSubmatch(file.Name)
-				if filename == nil {
-					log.Fatal().Msgf("could not strip suffix from filename %s", file.Name)
+			picks = newPicks(withoutFiles(pickedFiles, failed), destinations)
+			if options.Playlist != "" {
+				playlistErr := writePlaylist(options, withoutFiles(pickedFiles, failed), destinations)
+				if playlistErr != nil {
+					return files, nil, playlistErr
 				}
-				var combinedFilename string
-				for counter := 0; ; counter++ {
-					if counter == 0 {
-						combinedFilename = file.Name
-					} else {
-						combinedFilename = fmt.Sprintf("%s-%d.%s", filename[1], counter, filename[2])
+			}
+			if options.HTMLGallery {
+				if options.PlaylistOnly || options.DestinationFormat != DIRECTORY || isRemotePath(options.Destination) {
+					log.Warn().Msg("the HTML gallery requires copying the files into a destination folder, skipping")
+				} else {
+					var galleryFolder string = options.Destination
+					if options.DestinationOption == ROTATE {
+						galleryFolder = path.Join(options.Destination, currentBatchLink)
 					}
-					log.Debug().Msgf("attempting to copy %s -> %s", file.Path, combinedFilename)
-					_, err := copyFile(file.Path, path.Join(options.Destination, combinedFilename))
-					if err != nil {
-						if options.DestinationOption == APPEND && err == ErrDestinationFileAlreadyExists {
-							// Check for filename collision.
-							log.Debug().Msgf("filename collision: %s already exists", file.Path)
-						} else {
-							log.Fatal().Msgf("error copying %s to %s (%s)", file.Path, options.Destination, err.Error())
-						}
-					} else {
-						break
+					galleryErr := writeGallery(galleryFolder, time.Now())
+					if galleryErr != nil {
+						return files, nil, galleryErr
 					}
 				}
-				log.Debug().Msgf("successfully copied %s", combinedFilename)
-				file.LastPicked = time.Now().UTC()
 			}
+			markPickedFiles(files, pickedFiles, failed, time.Now().UTC())
 		} else {
 			log.Info().Msg("could not find any eligible files")
 		}
 	} else {
 		log.Info().Msg("dry-run, skipping copying of files")
+		destinations = plannedDestinations(options, pickedFiles)
+		picks = newPicks(pickedFiles, destinations)
+		if options.Playlist != "" && len(pickedFiles) > 0 {
+			// Nothing was copied, so the playlist lists the source files.
+			playlistErr := writePlaylist(options, pickedFiles, nil)
+			if playlistErr != nil {
+				return files, nil, playlistErr
+			}
+		}
+	}
+	if options.Output != NOOUTPUT {
+		outputErr := writePicks(os.Stdout, options.Output, picks)
+		if outputErr != nil {
+			return files, nil, outputErr
+		}
+	}
+	return files, picks, err
+}
+
+// withoutFiles returns the files in `files` that are not in `exclude`.
+func withoutFiles(files, exclude Files) Files {
+	var excluded map[string]bool = map[string]bool{}
+	for _, file := range exclude {
+		excluded[file.Md5sum] = true
+	}
+	var result Files = Files{}
+	for _, file := range files {
+		if !excluded[file.Md5sum] {
+			result = append(result, file)
+		}
+	}
+	return result
+}
+
+// pickWeight returns the relative chance of `file` to be picked; favourites
+// are picked more often.
+func pickWeight(file File) int {
+	if file.Favourite {
+		return favouriteWeight
+	}
+	return 1
+}
+
+// markPickedFiles sets the LastPicked timestamp of all files in `files` that
+// were picked, i.e. are in `pickedFiles` but not in `failedFiles`, and adds
+// the pick to their pick count and history.
+func markPickedFiles(files, pickedFiles, failedFiles Files, now time.Time) {
+	var picked map[string]bool = map[string]bool{}
+	for _, file := range pickedFiles {
+		picked[file.Md5sum] = true
+	}
+	for _, file := range failedFiles {
+		delete(picked, file.Md5sum)
+	}
+	for i := range files {
+		if picked[files[i].Md5sum] {
+			files[i].LastPicked = now
+			files[i].PickCount++
+			files[i].PickHistory = append(files[i].PickHistory, now)
+			if len(files[i].PickHistory) > pickHistoryLength {
+				files[i].PickHistory = files[i].PickHistory[len(files[i].PickHistory)-pickHistoryLength:]
+			}
+		}
+	}
+}
+
+// renameOnCollision returns true if picked files colliding with existing
+// files at the destination are renamed instead of failing the run. Files not
+// placed by pick-files are kept in the destination folder unless
+// `options.ForceClean` is set and might collide with the picked files.
+func renameOnCollision(options ProgramOptions) bool {
+	return options.DestinationOption == APPEND ||
+		options.DestinationOption != PANIC && !options.ForceClean
+}
+
+// placePickedFiles copies the picked files into the destination according to
+// the destination option and returns the destination paths of the picked files
+// keyed by their source path. Files that failed verification are reported in a
+// VerificationError. No destination paths are returned if none of the files
+// were placed, e.g. with the atomic option.
+func placePickedFiles(options ProgramOptions, pickedFiles Files) (map[string]string, error) {
+	if u, ok := remoteURL(options.Destination); ok {
+		return copyFilesToRemote(options, u, pickedFiles)
+	}
+	if options.DestinationFormat != DIRECTORY {
+		return writeArchive(options, pickedFiles)
+	}
+	switch options.DestinationOption {
+	case ATOMIC:
+		return copyFilesAtomically(options, pickedFiles)
+	case ROTATE:
+		return copyFilesToBatch(options, pickedFiles, time.Now())
+	case SYNC:
+		return syncPickedFiles(options, pickedFiles)
+	}
+
+	var previouslyPlaced []string = []string{}
+	_, err := os.Stat(options.Destination)
+	if err == nil {
+		switch options.DestinationOption {
+		case DELETE, TRASH:
+			log.Info().Msgf("removing files in destination folder %s", options.Destination)
+			names, err := removableEntries(options.Destination, options.ForceClean)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read destination folder %s: %s", options.Destination, err.Error())
+			}
+			var now time.Time = time.Now()
+			for _, name := range names {
+				var entry string = path.Join(options.Destination, name)
+				if options.DestinationOption == TRASH {
+					log.Debug().Msgf("trashing %s", entry)
+					err = moveToTrash(entry, now)
+				} else {
+					log.Debug().Msgf("removing %s", entry)
+					err = os.Remove(entry)
+				}
+				if err != nil {
+					return nil, fmt.Errorf("cannot remove %s: %s", name, err.Error())
+				}
+			}
+		case APPEND:
+			log.Debug().Msg("appending files to existing destination")
+			previouslyPlaced, err = readManifest(options.Destination)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		default:
+			return nil, errors.New("destination folder already exists, aborting")
+		}
+	}
+	err = os.MkdirAll(options.Destination, os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("error creating destination folder %s: %s", options.Destination, err.Error())
 	}
-	return files
+	placed, err := copyPickedFiles(options.Destination, pickedFiles, renameOnCollision(options), options)
+	var verificationError *VerificationError
+	if err != nil && !errors.As(err, &verificationError) {
+		return nil, err
+	}
+	manifestErr := writeManifest(options.Destination, append(previouslyPlaced, placedNames(placed)...))
+	if manifestErr != nil {
+		return nil, manifestErr
+	}
+	return placedPaths(options.Destination, placed), err
 }
 
-// refreshLastPicked refreshes the LastPicked timestamp in newFiles from entries
-// in oldFiles. It returns a new Files lit with the same files as in newFiles
-// but with updated timestamps.
+// refreshLastPicked refreshes the LastPicked timestamp, the pick count and
+// history, and the banned and favourite flags in newFiles from entries in
+// oldFiles. It returns a new Files lit with the same files as in newFiles but
+// with updated timestamps.
 func refreshLastPicked(oldFiles, newFiles Files) Files {
 	var result Files = Files{}
 	for _, file := range newFiles {
 		for _, oldFile := range oldFiles {
 			if file.Md5sum == oldFile.Md5sum {
 				file.LastPicked = oldFile.LastPicked
+				file.PickCount = oldFile.PickCount
+				file.PickHistory = oldFile.PickHistory
+				file.Banned = oldFile.Banned
+				file.Favourite = oldFile.Favourite
 				break
 			}
 		}
@@ -414,7 +1090,8 @@ func refreshLastPicked(oldFiles, newFiles Files) Files {
 }
 
 // mergeFiles merges two Files objects such that the most recent lastPicked and
-// lastSeen timestamps are used in case both lists hold the same file.
+// lastSeen timestamps are used in case both lists hold the same file. The
+// banned and favourite flags are taken from `a`.
 func mergeFiles(a, b Files) Files {
 	var result Files = Files{}
 	for _, fileA := range a {
@@ -423,9 +1100,12 @@ func mergeFiles(a, b Files) Files {
 			if fileA.Md5sum == fileB.Md5sum {
 				if fileA.LastPicked.Compare(fileB.LastPicked) <= 0 {
 					merged.LastPicked = fileB.LastPicked
+					merged.PickCount = fileB.PickCount
+					merged.PickHistory = fileB.PickHistory
 				}
 				if fileA.LastSeen.Compare(fileB.LastSeen) <= 0 {
 					merged.LastSeen = fileB.LastSeen
+					merged.Removed = fileB.Removed
 				}
 			}
 		}
@@ -456,41 +1136,123 @@ func main() {
 
 	if options.resetDatabase {
 		createDB(true)
-		if len(options.Folders) == 0 {
+		if !options.hasSources() {
 			return
 		}
 	}
-	var allFiles Files = loadDB()
 
 	if options.printDatabase != "" {
-		printDatabase(options, allFiles)
+		printDatabase(options, loadDB())
 		return
 	}
 
 	if options.printDatabaseStatistics {
-		fmt.Println(getDatabaseStatistics(allFiles))
-		if len(options.Folders) == 0 {
+		fmt.Println(getDatabaseStatistics(loadDB()))
+		if !options.hasSources() {
 			return
 		}
 	}
 
-	if len(options.Folders) == 0 {
-		log.Fatal().Msg("No folders were specified. Use the --folder option.")
+	switch options.command {
+	case "watch":
+		if len(options.Folders) == 0 {
+			log.Fatal().Msg("No folders were specified. Use the --folder option.")
+		}
+		watchFolders(options)
+		return
+	case "daemon":
+		runDaemon(options)
+		return
+	case "serve":
+		runServer(options, false)
+		return
+	case "systemd":
+		runSystemdCommand(options)
+		return
+	case "ui":
+		runServer(options, true)
+		return
+	}
+
+	if !options.hasSources() {
+		log.Fatal().Msg("No folders were specified. Use the --folder or --files-from option.")
 	}
 
 	log.Info().Msgf("%s-%s", path.Base(os.Args[0]), Version)
+	_, err := runPicks(options)
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+
+	log.Info().Msg("done")
+}
+
+// runPicks picks files from the sources in `options`, records the picked
+// files in the database, and returns the picks. The webhook in `options` is
+// notified of the outcome and the email digest of the picks is sent.
+func runPicks(options ProgramOptions) ([]Pick, error) {
+	var started time.Time = time.Now()
+	picks, err := pickAndRecordFiles(options)
+	if options.NotifyWebhook != "" {
+		notifyErr := notifyWebhook(options.NotifyWebhook, newRunSummary(options, started, picks, err))
+		if notifyErr != nil {
+			log.Warn().Msg(notifyErr.Error())
+		}
+	}
+	if options.Email != nil && len(picks) > 0 && !options.dryRun {
+		emailErr := sendDigest(*options.Email, picks, time.Now())
+		if emailErr != nil {
+			log.Warn().Msg(emailErr.Error())
+		}
+	}
+	return picks, err
+}
+
+// pickAndRecordFiles picks files from the sources in `options`, records the
+// picked files in the database, and returns the picks.
+func pickAndRecordFiles(options ProgramOptions) ([]Pick, error) {
 	log.Info().Msgf("will pick %d file(s) randomly matching suffixes %s", options.NumberOfFiles, options.Suffixes.String())
 	if options.blockSelectionDuration > 0 {
 		log.Info().Msgf("will block files last picked less than %s ago", options.blockSelectionDuration.String())
 	}
-	log.Info().Msgf("source folders: %s", options.Folders.String())
-	log.Info().Msgf("selected files will go into the '%s' folder", options.Destination)
-
-	var files Files = refreshLastPicked(allFiles, getFilesFromFolders(options.Folders))
-	files = pickFiles(options, files)
-	allFiles = mergeFiles(allFiles, files)
-	allFiles = expireOldDBEntries(allFiles, options.dbExpirationAge)
-	storeDB(allFiles)
+	if len(options.Folders) > 0 {
+		log.Info().Msgf("source folders: %s", options.Folders.String())
+	}
+	if options.FilesFrom != "" {
+		log.Info().Msgf("source files read from: %s", options.FilesFrom)
+	}
+	if u, ok := remoteURL(options.Destination); ok {
+		log.Info().Msgf("selected files will go into the '%s' folder", redactedURL(u))
+	} else {
+		log.Info().Msgf("selected files will go into the '%s' folder", options.Destination)
+	}
 
-	log.Info().Msg("done")
+	var allFiles Files = loadDB()
+	var files Files = Files{}
+	var err error
+	if len(options.Folders) > 0 {
+		if options.SkipScan {
+			files = watchedFiles(allFiles, options.Folders)
+		} else {
+			files, err = getFilesFromFolders(options.Folders)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if options.FilesFrom != "" {
+		listFiles, err := getFilesFromList(options.FilesFrom)
+		if err != nil {
+			return nil, err
+		}
+		files = uniqueFiles(append(files, listFiles...))
+	}
+	files = refreshLastPicked(allFiles, files)
+	files, picks, err := pickFiles(options, files)
+	// Merge into the current database rather than `allFiles` since the
+	// database may have changed during the run, e.g. by `pick-files watch`.
+	updateDB(func(allFiles Files) Files {
+		return expireOldDBEntries(mergeFiles(allFiles, files), options.dbExpirationAge)
+	})
+	return picks, err
 }
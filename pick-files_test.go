@@ -1,6 +1,13 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -10,7 +17,7 @@ func compareFileList(a, b Files) bool {
 		return false
 	}
 	for i := 0; i < len(a); i++ {
-		if a[i] != b[i] {
+		if !reflect.DeepEqual(a[i], b[i]) {
 			return false
 		}
 	}
@@ -65,9 +72,179 @@ func TestRefreshLastPicked(t *testing.T) {
 
 func TestGetFilesFromFolders(t *testing.T) {}
 
-func TestCopyFiles(t *testing.T) {}
+func TestCopyFiles(t *testing.T) {
+	var tempDir string = t.TempDir()
+	var src string = path.Join(tempDir, "src.jpg")
+	var modTime time.Time = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.WriteFile(src, []byte("content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(src, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	var dst string = path.Join(tempDir, "dst.jpg")
+	nBytes, err := copyFile(src, dst, PreserveAttributes{Mode: true, Times: true})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	if nBytes != 7 {
+		t.Errorf("expected 7 bytes copied but got %d", nBytes)
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode %s but got %s", os.FileMode(0600), info.Mode().Perm())
+	}
+	if !info.ModTime().Equal(modTime) {
+		t.Errorf("expected modification time %s but got %s", modTime, info.ModTime())
+	}
+
+	_, err = copyFile(src, dst, PreserveAttributes{})
+	if err != ErrDestinationFileAlreadyExists {
+		t.Errorf("expected %s but got %v", ErrDestinationFileAlreadyExists, err)
+	}
+}
+
+func TestCopyFilesAtomically(t *testing.T) {
+	var tempDir string = t.TempDir()
+	var src string = path.Join(tempDir, "a.jpg")
+	if err := os.WriteFile(src, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var destination string = path.Join(tempDir, "output")
+	if err := os.MkdirAll(destination, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(destination, "old.jpg"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var options ProgramOptions = ProgramOptions{Destination: destination, DestinationOption: ATOMIC}
+	_, err := copyFilesAtomically(options, Files{File{Name: "a.jpg", Path: src}, File{Name: "a.jpg", Path: src}})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	for _, name := range []string{"output/a.jpg", "output/a-1.jpg", "output.prev/old.jpg"} {
+		if _, err := os.Stat(path.Join(tempDir, name)); err != nil {
+			t.Errorf("expected %s to exist", name)
+		}
+	}
+	if _, err := os.Stat(path.Join(destination, "old.jpg")); err == nil {
+		t.Errorf("expected old.jpg to be moved out of the destination")
+	}
+
+	_, err = copyFilesAtomically(options, Files{File{Name: "b.jpg", Path: path.Join(tempDir, "missing.jpg")}})
+	if err == nil {
+		t.Fatalf("expected error copying a missing file")
+	}
+	for _, name := range []string{"output/a.jpg", "output.prev/old.jpg"} {
+		if _, err := os.Stat(path.Join(tempDir, name)); err != nil {
+			t.Errorf("expected %s to be left untouched", name)
+		}
+	}
+	if _, err := os.Stat(path.Join(tempDir, "output.staging")); err == nil {
+		t.Errorf("expected staging folder to be removed")
+	}
+
+	// A corrupted copy is simulated with a wrong md5 sum.
+	var corrupted string = path.Join(tempDir, "c.jpg")
+	if err := os.WriteFile(corrupted, []byte("c"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	options.Verify = true
+	options.VerifyRetries = 1
+	destinations, err := copyFilesAtomically(options, Files{File{Name: "a.jpg", Path: src}, File{Name: "c.jpg", Path: corrupted, Md5sum: "corrupted"}})
+	var verificationError *VerificationError
+	if !errors.As(err, &verificationError) || destinations != nil {
+		t.Fatalf("expected verification error and no destinations but got %v, %v", destinations, err)
+	}
+	for _, name := range []string{"output/a.jpg", "output/a-1.jpg", "output.prev/old.jpg"} {
+		if _, err := os.Stat(path.Join(tempDir, name)); err != nil {
+			t.Errorf("expected %s to be left untouched after a failed verification", name)
+		}
+	}
+	if _, err := os.Stat(path.Join(destination, "c.jpg")); err == nil {
+		t.Errorf("expected c.jpg not to be placed after a failed verification")
+	}
+	if _, err := os.Stat(path.Join(tempDir, "output.staging")); err == nil {
+		t.Errorf("expected staging folder to be removed after a failed verification")
+	}
+}
+
+func TestPreserveAttributesSet(t *testing.T) {
+	var preserve PreserveAttributes
+	if err := preserve.Set("mode,times"); err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	if preserve != (PreserveAttributes{Mode: true, Times: true}) {
+		t.Errorf("expected mode,times but got %s", preserve.String())
+	}
+	if err := preserve.Set("xattrs"); err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	if preserve.String() != "mode,times,xattrs" {
+		t.Errorf("expected mode,times,xattrs but got %s", preserve.String())
+	}
+	if err := preserve.Set("owner"); err == nil {
+		t.Errorf("expected error for unknown attribute")
+	}
+}
+
+func TestPickFiles(t *testing.T) {
+	var tempDir string = t.TempDir()
+	var files Files = Files{}
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		var src string = path.Join(tempDir, name)
+		if err := os.WriteFile(src, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		md5sum, err := md5sumFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, File{Name: name, Path: src, Md5sum: md5sum})
+	}
+	// A corrupted copy is simulated with a wrong md5 sum.
+	files[1].Md5sum = "corrupted"
 
-func TestPickFiles(t *testing.T) {}
+	var options ProgramOptions = ProgramOptions{
+		Destination:       path.Join(tempDir, "output"),
+		DestinationOption: PANIC,
+		NumberOfFiles:     2,
+		Verify:            true,
+		VerifyRetries:     1,
+	}
+	files, picks, err := pickFiles(options, files)
+	var verificationError *VerificationError
+	if !errors.As(err, &verificationError) {
+		t.Fatalf("expected verification error but got %v", err)
+	}
+	if len(verificationError.Files) != 1 || verificationError.Files[0].Name != "b.jpg" {
+		t.Errorf("expected verification of b.jpg to fail but got %s", verificationError.Files)
+	}
+	if files[0].LastPicked.IsZero() {
+		t.Errorf("expected a.jpg to be marked as picked")
+	}
+	if len(picks) != 1 || picks[0].Destination != path.Join(options.Destination, "a.jpg") {
+		t.Errorf("expected only a.jpg to be reported as picked but got %v", picks)
+	}
+	if !files[1].LastPicked.IsZero() {
+		t.Errorf("expected b.jpg not to be marked as picked")
+	}
+	if _, err := os.Stat(path.Join(options.Destination, "b.jpg")); err == nil {
+		t.Errorf("expected corrupted copy of b.jpg to be removed")
+	}
+	placed, err := readManifest(options.Destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(placed, ",") != "a.jpg" {
+		t.Errorf("expected manifest a.jpg but got %s", strings.Join(placed, ","))
+	}
+}
 
 func TestCreateDB(t *testing.T) {}
 
@@ -76,7 +253,6 @@ func TestLoadDB(t *testing.T) {}
 func TestStoreDB(t *testing.T) {}
 
 func TestConvertDurationString(t *testing.T) {
-	var duration time.Duration
 	testInput := []string{
 		"1m", "1h", "1d", "1w",
 	}
@@ -84,11 +260,199 @@ func TestConvertDurationString(t *testing.T) {
 		time.Minute, time.Hour, 24 * time.Hour, 24 * 7 * time.Hour,
 	}
 	for i := range testInput {
-		duration = convertDurationString(testInput[i])
+		duration, err := convertDurationString(testInput[i])
+		if err != nil {
+			t.Fatal(err)
+		}
 		if duration != testOutput[i] {
 			t.Errorf("expected %s but got %s", testOutput[i], duration)
 		}
 	}
+	if _, err := convertDurationString("1x"); err == nil {
+		t.Errorf("expected error for invalid duration 1x")
+	}
 }
 
 func TestGetDatabaseStatistics(t *testing.T) {}
+
+func TestSyncPickedFiles(t *testing.T) {
+	var tempDir string = t.TempDir()
+	var destination string = path.Join(tempDir, "output")
+	if err := os.MkdirAll(destination, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	var pickedFiles Files = Files{}
+	for _, name := range []string{"keep.jpg", "new.jpg"} {
+		var src string = path.Join(tempDir, name)
+		if err := os.WriteFile(src, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		md5sum, err := md5sumFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pickedFiles = append(pickedFiles, File{Name: name, Path: src, Md5sum: md5sum})
+	}
+	if err := os.WriteFile(path.Join(destination, "renamed-keep.jpg"), []byte("keep.jpg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(destination, "stale.jpg"), []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(destination, "foreign.jpg"), []byte("foreign"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeManifest(destination, []string{"renamed-keep.jpg", "stale.jpg"}); err != nil {
+		t.Fatal(err)
+	}
+
+	destinations, err := syncPickedFiles(ProgramOptions{Destination: destination, DestinationOption: SYNC}, pickedFiles)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	if destinations[pickedFiles[0].Path] != path.Join(destination, "renamed-keep.jpg") {
+		t.Errorf("expected keep.jpg at renamed-keep.jpg but got %s", destinations[pickedFiles[0].Path])
+	}
+	dirEntries, err := os.ReadDir(destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string = []string{}
+	for _, entry := range dirEntries {
+		names = append(names, entry.Name())
+	}
+	var expectedNames string = manifestFilename + ",foreign.jpg,new.jpg,renamed-keep.jpg"
+	if strings.Join(names, ",") != expectedNames {
+		t.Errorf("expected %s but got %s", expectedNames, strings.Join(names, ","))
+	}
+	placed, err := readManifest(destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(placed, ",") != "new.jpg,renamed-keep.jpg" {
+		t.Errorf("expected manifest new.jpg,renamed-keep.jpg but got %s", strings.Join(placed, ","))
+	}
+}
+
+func TestCopyPickedFilesConcurrently(t *testing.T) {
+	var tempDir string = t.TempDir()
+	var pickedFiles Files = Files{}
+	for i := 0; i < 8; i++ {
+		var folder string = path.Join(tempDir, fmt.Sprintf("folder%d", i))
+		if err := os.Mkdir(folder, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path.Join(folder, "a.jpg"), []byte(folder), 0644); err != nil {
+			t.Fatal(err)
+		}
+		pickedFiles = append(pickedFiles, File{Name: "a.jpg", Path: path.Join(folder, "a.jpg")})
+	}
+	var destination string = path.Join(tempDir, "output")
+	if err := os.Mkdir(destination, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	placed, err := copyPickedFiles(destination, pickedFiles, true, ProgramOptions{CopyJobs: 4})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	for i, file := range pickedFiles {
+		var name string = placed[file.Path]
+		var expectedName string = "a.jpg"
+		if i > 0 {
+			expectedName = fmt.Sprintf("a-%d.jpg", i)
+		}
+		if name != expectedName {
+			t.Errorf("expected %s but got %s", expectedName, name)
+		}
+		content, err := os.ReadFile(path.Join(destination, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != path.Dir(pickedFiles[i].Path) {
+			t.Errorf("expected %s to be a copy of %s", name, pickedFiles[i].Path)
+		}
+	}
+
+	pickedFiles[3].Path = path.Join(tempDir, "missing.jpg")
+	placed, err = copyPickedFiles(destination, pickedFiles, true, ProgramOptions{CopyJobs: 4})
+	if err == nil {
+		t.Fatalf("expected error copying a missing file")
+	}
+	if len(placed) != 7 {
+		t.Errorf("expected the other 7 files to be copied but got %d", len(placed))
+	}
+}
+
+func TestMarkPickedFiles(t *testing.T) {
+	var now time.Time = time.Now()
+	var history []time.Time = []time.Time{}
+	for i := 0; i < pickHistoryLength; i++ {
+		history = append(history, now.Add(-time.Duration(pickHistoryLength-i)*time.Hour))
+	}
+	var files Files = Files{
+		{Name: "a", Md5sum: "a", PickCount: pickHistoryLength, PickHistory: history},
+		{Name: "b", Md5sum: "b"},
+		{Name: "c", Md5sum: "c"},
+	}
+	markPickedFiles(files, Files{files[0], files[1]}, Files{files[1]}, now)
+	if files[0].PickCount != pickHistoryLength+1 || len(files[0].PickHistory) != pickHistoryLength ||
+		!files[0].PickHistory[pickHistoryLength-1].Equal(now) || !files[0].PickHistory[0].Equal(history[1]) {
+		t.Errorf("unexpected pick count %d and history %v of a", files[0].PickCount, files[0].PickHistory)
+	}
+	if files[1].PickCount != 0 || files[2].PickCount != 0 {
+		t.Errorf("expected b and c not to be marked as picked")
+	}
+}
+
+func TestPickFilesSkipsBannedFiles(t *testing.T) {
+	var files Files = Files{
+		{Name: "a.jpg", Path: "/a.jpg", Md5sum: "a", Banned: true},
+		{Name: "b.jpg", Path: "/b.jpg", Md5sum: "b", Favourite: true},
+		{Name: "c.jpg", Path: "/c.jpg", Md5sum: "c"},
+	}
+	var options ProgramOptions = ProgramOptions{dryRun: true, NumberOfFiles: 3}
+	_, picks, err := pickFiles(options, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(picks) != 2 {
+		t.Fatalf("expected 2 picks but got %v", picks)
+	}
+	for _, pick := range picks {
+		if pick.Md5sum == "a" {
+			t.Errorf("expected banned a.jpg not to be picked")
+		}
+	}
+}
+
+func TestPickFilesWritesEmptyOutput(t *testing.T) {
+	var files Files = Files{{Name: "a.jpg", Path: "/a.jpg", Md5sum: "a", Banned: true}}
+	for _, dryRun := range []bool{true, false} {
+		var options ProgramOptions = ProgramOptions{
+			Destination:   path.Join(t.TempDir(), "output"),
+			NumberOfFiles: 1,
+			Output:        JSONOUTPUT,
+			dryRun:        dryRun,
+		}
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var stdout *os.File = os.Stdout
+		os.Stdout = writer
+		_, picks, err := pickFiles(options, files)
+		os.Stdout = stdout
+		writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		output, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(picks) != 0 || string(output) != "[]\n" {
+			t.Errorf("expected an empty list with dry-run %v but got %q", dryRun, string(output))
+		}
+	}
+}
@@ -0,0 +1,33 @@
+//go:build !linux
+
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// accessTime returns the last access time of a file. Platforms other than
+// Linux fall back to the modification time.
+func accessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
+
+// copyXattrs is not supported on this platform.
+func copyXattrs(src, dst string) error {
+	log.Warn().Msgf("extended attributes are not supported on this platform, skipping %s", src)
+	return nil
+}
+
+// deviceID is not supported on this platform.
+func deviceID(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+// lockFile is not supported on this platform; concurrent updates of the
+// database are not serialized.
+func lockFile(f *os.File) error {
+	return nil
+}
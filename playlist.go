@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// xspfPlaylist is the XML Shareable Playlist Format, see https://xspf.org.
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"http://xspf.org/ns/0/ playlist"`
+	Version int         `xml:"version,attr"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location string `xml:"location"`
+	Title    string `xml:"title"`
+}
+
+// playlistEntries returns the paths of the picked files as written into the
+// playlist `playlist`. These are the paths in `destinations`, keyed by source
+// path, or the source paths of files missing from `destinations`. If
+// `relative` is true then local paths are relative to the folder of the
+// playlist, otherwise they are absolute. Remote paths and archive members are
+// written unchanged.
+func playlistEntries(playlist string, pickedFiles Files, destinations map[string]string, relative bool) ([]string, error) {
+	playlistFolder, err := filepath.Abs(path.Dir(playlist))
+	if err != nil {
+		return nil, err
+	}
+	var entries []string = []string{}
+	for _, file := range pickedFiles {
+		var filename string = file.Path
+		if destination, ok := destinations[file.Path]; ok {
+			filename = destination
+		}
+		if _, _, ok := splitArchiveMemberPath(filename); ok || isRemotePath(filename) {
+			entries = append(entries, filename)
+			continue
+		}
+		entry, err := filepath.Abs(filename)
+		if err != nil {
+			return nil, err
+		}
+		if relative {
+			entry, err = filepath.Rel(playlistFolder, entry)
+			if err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// renderPlaylist renders a playlist of the picked files in the format given
+// by the extension of `playlist`, i.e. M3U (.m3u, .m3u8), PLS (.pls), or XSPF
+// (.xspf).
+func renderPlaylist(playlist string, pickedFiles Files, destinations map[string]string, relative bool) ([]byte, error) {
+	entries, err := playlistEntries(playlist, pickedFiles, destinations, relative)
+	if err != nil {
+		return nil, err
+	}
+	var result bytes.Buffer
+	switch strings.ToLower(path.Ext(playlist)) {
+	case ".m3u", ".m3u8":
+		result.WriteString("#EXTM3U\n")
+		for i, entry := range entries {
+			fmt.Fprintf(&result, "#EXTINF:-1,%s\n%s\n", pickedFiles[i].Name, entry)
+		}
+	case ".pls":
+		result.WriteString("[playlist]\n")
+		for i, entry := range entries {
+			fmt.Fprintf(&result, "File%d=%s\nTitle%d=%s\n", i+1, entry, i+1, pickedFiles[i].Name)
+		}
+		fmt.Fprintf(&result, "NumberOfEntries=%d\nVersion=2\n", len(entries))
+	case ".xspf":
+		var xspf xspfPlaylist = xspfPlaylist{Version: 1, Tracks: []xspfTrack{}}
+		for i, entry := range entries {
+			if isRemotePath(entry) {
+				xspf.Tracks = append(xspf.Tracks, xspfTrack{Location: entry, Title: pickedFiles[i].Name})
+				continue
+			}
+			var location url.URL = url.URL{Path: filepath.ToSlash(entry)}
+			if !relative && filepath.IsAbs(entry) {
+				location.Scheme = "file"
+			}
+			xspf.Tracks = append(xspf.Tracks, xspfTrack{Location: location.String(), Title: pickedFiles[i].Name})
+		}
+		encoded, err := xml.MarshalIndent(xspf, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		result.WriteString(xml.Header)
+		result.Write(encoded)
+		result.WriteString("\n")
+	default:
+		return nil, fmt.Errorf("unknown playlist format of %s; use .m3u, .m3u8, .pls, or .xspf", playlist)
+	}
+	return result.Bytes(), nil
+}
+
+// writePlaylist writes a playlist of the picked files to `options.Playlist`.
+// The playlist lists the copies in `destinations`, keyed by source path, if
+// the files were copied into a local destination folder, and the source files
+// otherwise.
+func writePlaylist(options ProgramOptions, pickedFiles Files, destinations map[string]string) error {
+	if options.PlaylistOnly || options.DestinationFormat != DIRECTORY || isRemotePath(options.Destination) {
+		destinations = nil
+	}
+	content, err := renderPlaylist(options.Playlist, pickedFiles, destinations, options.PlaylistRelative)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(options.Playlist, content, 0644)
+	if err != nil {
+		return fmt.Errorf("error writing playlist %s: %s", options.Playlist, err.Error())
+	}
+	log.Info().Msgf("wrote playlist %s with %d file(s)", options.Playlist, len(pickedFiles))
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestRenderPlaylist(t *testing.T) {
+	var tempDir string = t.TempDir()
+	var pickedFiles Files = Files{
+		File{Name: "a.mp3", Path: path.Join(tempDir, "music", "a.mp3")},
+		File{Name: "b c.mp3", Path: path.Join(tempDir, "music", "b c.mp3")},
+	}
+	var playlist string = path.Join(tempDir, "lists", "out.m3u")
+
+	content, err := renderPlaylist(playlist, pickedFiles, nil, true)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	var expected string = "#EXTM3U\n#EXTINF:-1,a.mp3\n../music/a.mp3\n#EXTINF:-1,b c.mp3\n../music/b c.mp3\n"
+	if string(content) != expected {
+		t.Errorf("expected %q but got %q", expected, string(content))
+	}
+
+	content, err = renderPlaylist(path.Join(tempDir, "out.pls"), pickedFiles, nil, false)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	if !strings.Contains(string(content), "File2="+pickedFiles[1].Path+"\nTitle2=b c.mp3\nNumberOfEntries=2\n") {
+		t.Errorf("unexpected PLS playlist %q", string(content))
+	}
+
+	content, err = renderPlaylist(path.Join(tempDir, "out.xspf"), pickedFiles, nil, false)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	if !strings.Contains(string(content), "<location>file://"+path.Join(tempDir, "music", "b%20c.mp3")+"</location>") {
+		t.Errorf("unexpected XSPF playlist %q", string(content))
+	}
+
+	_, err = renderPlaylist(path.Join(tempDir, "out.txt"), pickedFiles, nil, false)
+	if err == nil {
+		t.Errorf("expected error for unknown playlist format")
+	}
+}
+
+func TestPlaylistEntries(t *testing.T) {
+	var tempDir string = t.TempDir()
+	var archive string = path.Join(tempDir, "music.zip")
+	if err := os.WriteFile(archive, []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var playlist string = path.Join(tempDir, "lists", "out.m3u")
+
+	var tests = []struct {
+		name        string
+		source      string
+		destination string
+		relative    bool
+		expected    string
+	}{
+		{"local source", path.Join(tempDir, "music", "a.mp3"), "", false, path.Join(tempDir, "music", "a.mp3")},
+		{"relative local source", path.Join(tempDir, "music", "a.mp3"), "", true, "../music/a.mp3"},
+		{"local destination", "sftp://host/music/a.mp3", path.Join(tempDir, "output", "a.mp3"), true, "../output/a.mp3"},
+		{"remote source", "sftp://host/music/a.mp3", "", false, "sftp://host/music/a.mp3"},
+		{"relative remote source", "s3://bucket/music/a.mp3", "", true, "s3://bucket/music/a.mp3"},
+		{"remote destination", path.Join(tempDir, "music", "a.mp3"), "davs://host/output/a.mp3", true, "davs://host/output/a.mp3"},
+		{"archive member", archive + "!a.mp3", "", true, archive + "!a.mp3"},
+	}
+	for _, test := range tests {
+		var destinations map[string]string = map[string]string{}
+		if test.destination != "" {
+			destinations[test.source] = test.destination
+		}
+		entries, err := playlistEntries(playlist, Files{File{Name: "a.mp3", Path: test.source}}, destinations, test.relative)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %s", test.name, err.Error())
+		}
+		if len(entries) != 1 || entries[0] != test.expected {
+			t.Errorf("%s: expected entry %s but got %v", test.name, test.expected, entries)
+		}
+	}
+
+	content, err := renderPlaylist(path.Join(tempDir, "out.xspf"), Files{File{Name: "a.mp3", Path: "sftp://host/music/a%20b.mp3"}}, nil, false)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	if !strings.Contains(string(content), "<location>sftp://host/music/a%20b.mp3</location>") {
+		t.Errorf("unexpected XSPF playlist %q", string(content))
+	}
+}
+
+func TestWritePlaylist(t *testing.T) {
+	var tempDir string = t.TempDir()
+	var src string = path.Join(tempDir, "a.mp3")
+	if err := os.WriteFile(src, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var files Files = Files{File{Name: "a.mp3", Path: src, Md5sum: "a"}}
+	var destination string = path.Join(tempDir, "output")
+	var options ProgramOptions = ProgramOptions{
+		Destination:       destination,
+		DestinationOption: PANIC,
+		NumberOfFiles:     1,
+		Playlist:          path.Join(tempDir, "out.m3u"),
+		dryRun:            true,
+	}
+
+	// expectEntry checks that the playlist lists `expected`.
+	expectEntry := func(expected string) {
+		t.Helper()
+		content, err := os.ReadFile(options.Playlist)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(string(content), "\n"+expected+"\n") {
+			t.Errorf("expected playlist entry %s but got %q", expected, string(content))
+		}
+		os.Remove(options.Playlist)
+	}
+
+	if _, _, err := pickFiles(options, files); err != nil {
+		t.Fatal(err)
+	}
+	expectEntry(src)
+	if _, err := os.Stat(destination); err == nil {
+		t.Errorf("expected no files to be copied with --dry-run")
+	}
+
+	options.dryRun = false
+	if _, _, err := pickFiles(options, files); err != nil {
+		t.Fatal(err)
+	}
+	expectEntry(path.Join(destination, "a.mp3"))
+
+	options.PlaylistOnly = true
+	if _, _, err := pickFiles(options, files); err != nil {
+		t.Fatal(err)
+	}
+	expectEntry(src)
+
+	var remoteFiles Files = Files{File{Name: "a.mp3", Path: "sftp://host/music/a.mp3", Md5sum: "a"}}
+	if err := writePlaylist(options, remoteFiles, nil); err != nil {
+		t.Fatal(err)
+	}
+	expectEntry("sftp://host/music/a.mp3")
+
+	options.PlaylistOnly = false
+	options.Destination = "sftp://host/output"
+	if err := writePlaylist(options, files, map[string]string{src: "sftp://host/output/a.mp3"}); err != nil {
+		t.Fatal(err)
+	}
+	expectEntry(src)
+}
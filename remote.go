@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// remoteIOTimeout is how long a connection to a remote server may stall before
+// the transfer is given up.
+var remoteIOTimeout time.Duration = time.Minute
+
+// remoteHTTPClient is the client talking to HTTP based remote servers. It has
+// no overall timeout since copying large files takes a while; instead every
+// read and write on the connection has to finish within remoteIOTimeout.
+var remoteHTTPClient *http.Client = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var dialer net.Dialer = net.Dialer{Timeout: remoteIOTimeout}
+			connection, err := dialer.DialContext(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			return &idleTimeoutConn{Conn: connection, timeout: remoteIOTimeout}, nil
+		},
+		TLSHandshakeTimeout:   remoteIOTimeout,
+		ResponseHeaderTimeout: remoteIOTimeout,
+		IdleConnTimeout:       90 * time.Second,
+	},
+}
+
+// idleTimeoutConn is a connection whose reads and writes fail if they do not
+// finish within `timeout`.
+type idleTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *idleTimeoutConn) Read(b []byte) (int, error) {
+	c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(b)
+}
+
+func (c *idleTimeoutConn) Write(b []byte) (int, error) {
+	c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Write(b)
+}
+
+// remoteFolder is a folder on a remote server that can be used both as source
+// and as destination. Names are relative to the folder.
+type remoteFolder interface {
+	Source
+	fs.ReadDirFS
+	fs.StatFS
+	// MkdirAll creates the folder `name` and any missing parents.
+	MkdirAll(name string) error
+	// WriteFile writes `size` bytes read from `content` into the file `name`.
+	WriteFile(name string, content io.Reader, size int64) error
+	// Remove removes the file `name`.
+	Remove(name string) error
+}
+
+// remoteURL returns the parsed URL if `p` refers to a folder or file on a
+// supported remote server.
+func remoteURL(p string) (*url.URL, bool) {
+	u, err := url.Parse(p)
+	if err != nil {
+		return nil, false
+	}
+	switch u.Scheme {
+	case "dav", "davs", "sftp", "s3":
+		return u, true
+	}
+	return nil, false
+}
+
+// isRemotePath returns true if `p` refers to a folder or file on a supported
+// remote server.
+func isRemotePath(p string) bool {
+	_, ok := remoteURL(p)
+	return ok
+}
+
+// newRemoteFolder returns the remoteFolder for the URL `u`, which has to be
+// accepted by remoteURL. No connection is made until the folder is used.
+func newRemoteFolder(u *url.URL) remoteFolder {
+	switch u.Scheme {
+	case "sftp":
+		return newSFTPFolder(u)
+	case "s3":
+		return newS3Folder(u)
+	}
+	return newWebDAVFolder(u)
+}
+
+// remoteSourceOf returns the remote folder holding the file at URL `u` and the
+// name of the file in that folder.
+func remoteSourceOf(u *url.URL) (Source, string) {
+	var parent url.URL = *u
+	parent.Path = path.Dir(u.Path)
+	parent.RawPath = ""
+	return newRemoteFolder(&parent), path.Base(u.Path)
+}
+
+// redactedURL returns `u` without the password for logging and for recording
+// paths in the database.
+func redactedURL(u *url.URL) *url.URL {
+	var result url.URL = *u
+	if u.User != nil {
+		result.User = url.User(u.User.Username())
+	}
+	return &result
+}
+
+// remoteDestination adapts a remoteFolder as destination folder.
+type remoteDestination struct {
+	folder remoteFolder
+}
+
+func (d remoteDestination) Exists(name string) bool {
+	_, err := d.folder.Stat(name)
+	return err == nil
+}
+
+func (d remoteDestination) CopyFile(file File, name string, preserve PreserveAttributes) error {
+	source, info, err := openSourceFile(sourceOf(file.Path))
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	err = d.folder.WriteFile(name, source, info.Size())
+	if err != nil {
+		return err
+	}
+	log.Debug().Msgf("copied %s to %s", file.Path, d.Path(name))
+	return nil
+}
+
+func (d remoteDestination) Md5sum(name string) (string, error) {
+	return sourceMd5sum(d.folder, name)
+}
+
+func (d remoteDestination) Remove(name string) error {
+	return d.folder.Remove(name)
+}
+
+func (d remoteDestination) Path(name string) string {
+	return d.folder.Path(name)
+}
+
+// copyFilesToRemote copies the picked files into the remote destination folder
+// `u`. The destination options panic, append, and delete are supported and
+// behave like for a local destination folder, including the manifest. The
+// destination paths of the picked files are returned keyed by their source
+// path.
+func copyFilesToRemote(options ProgramOptions, u *url.URL, pickedFiles Files) (map[string]string, error) {
+	var folder remoteFolder = newRemoteFolder(u)
+	var destination string = folder.Path("")
+	if options.DestinationFormat != DIRECTORY {
+		return nil, fmt.Errorf("destination format %s is not supported for remote destination %s",
+			options.DestinationFormat.String(), destination)
+	}
+	switch options.DestinationOption {
+	case PANIC, APPEND, DELETE:
+	default:
+		return nil, fmt.Errorf("destination option %s is not supported for remote destination %s",
+			options.DestinationOption.String(), destination)
+	}
+
+	var previouslyPlaced []string = []string{}
+	entries, err := folder.ReadDir(".")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("unable to read destination folder %s: %s", destination, err.Error())
+	}
+	if err == nil {
+		switch options.DestinationOption {
+		case DELETE:
+			log.Info().Msgf("removing files in destination folder %s", destination)
+			names, err := remoteRemovableEntries(folder, entries, options.ForceClean)
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range names {
+				log.Debug().Msgf("removing %s", folder.Path(name))
+				err = folder.Remove(name)
+				if err != nil {
+					return nil, fmt.Errorf("cannot remove %s: %s", name, err.Error())
+				}
+			}
+		case APPEND:
+			log.Debug().Msg("appending files to existing destination")
+			previouslyPlaced, err = readRemoteManifest(folder)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+		default:
+			return nil, errors.New("destination folder already exists, aborting")
+		}
+	}
+	err = folder.MkdirAll(".")
+	if err != nil {
+		return nil, fmt.Errorf("error creating destination folder %s: %s", destination, err.Error())
+	}
+
+	var target remoteDestination = remoteDestination{folder: folder}
+	placed, err := copyPickedFilesInto(target, pickedFiles, renameOnCollision(options), options)
+	var verificationError *VerificationError
+	if err != nil && !errors.As(err, &verificationError) {
+		return nil, err
+	}
+	encoded, manifestErr := encodeManifest(append(previouslyPlaced, placedNames(placed)...))
+	if manifestErr == nil {
+		manifestErr = writeRemoteFile(folder, manifestFilename, encoded)
+	}
+	if manifestErr != nil {
+		return nil, fmt.Errorf("error writing manifest in %s: %s", destination, manifestErr.Error())
+	}
+	var paths map[string]string = map[string]string{}
+	for source, name := range placed {
+		paths[source] = folder.Path(name)
+	}
+	return paths, err
+}
+
+// readRemoteManifest returns the names of the files placed into the remote
+// folder by previous runs. The returned error wraps fs.ErrNotExist if there is
+// no manifest.
+func readRemoteManifest(folder remoteFolder) ([]string, error) {
+	encoded, err := fs.ReadFile(folder, manifestFilename)
+	if err != nil {
+		return nil, err
+	}
+	return decodeManifest(encoded, folder.Path(""))
+}
+
+// writeRemoteFile writes `content` into the file `name` of the remote folder.
+func writeRemoteFile(folder remoteFolder, name string, content []byte) error {
+	return folder.WriteFile(name, bytes.NewReader(content), int64(len(content)))
+}
+
+// remoteRemovableEntries returns the names of the files in the remote folder
+// with directory listing `entries` that may be removed, i.e. the files listed
+// in the manifest that still exist. If `forceClean` is true then all files
+// other than the manifest are returned. Sub-folders are never removed.
+func remoteRemovableEntries(folder remoteFolder, entries []fs.DirEntry, forceClean bool) ([]string, error) {
+	var existing map[string]bool = map[string]bool{}
+	var result []string = []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		existing[entry.Name()] = true
+		if forceClean && entry.Name() != manifestFilename {
+			result = append(result, entry.Name())
+		}
+	}
+	if forceClean {
+		return result, nil
+	}
+	names, err := readRemoteManifest(folder)
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Warn().Msgf("no manifest found in %s, not removing any files; use --force-clean to remove all files", folder.Path(""))
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if !isValidManifestEntry(name) {
+			log.Warn().Msgf("ignoring invalid manifest entry %s", name)
+			continue
+		}
+		if existing[name] {
+			result = append(result, name)
+		}
+	}
+	return result, nil
+}
+
+// remoteFileInfo describes a file or folder on a remote server.
+type remoteFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i *remoteFileInfo) Name() string       { return i.name }
+func (i *remoteFileInfo) Size() int64        { return i.size }
+func (i *remoteFileInfo) ModTime() time.Time { return i.modTime }
+func (i *remoteFileInfo) IsDir() bool        { return i.dir }
+func (i *remoteFileInfo) Sys() any           { return nil }
+
+func (i *remoteFileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+// remoteFile is a file on a remote server opened for reading.
+type remoteFile struct {
+	io.ReadCloser
+	info *remoteFileInfo
+}
+
+func (f *remoteFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// s3UnsignedPayload is used as payload hash for requests whose body is not
+// signed.
+const s3UnsignedPayload string = "UNSIGNED-PAYLOAD"
+
+// s3EmptyPayload is the SHA256 hash of an empty body.
+const s3EmptyPayload string = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3Credentials are the credentials used to sign requests to an S3 server.
+type s3Credentials struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	region       string
+}
+
+// s3Folder is a prefix in an S3 bucket given by a URL of the form
+// `s3://bucket/prefix`. The server and credentials are taken from the
+// environment variables AWS_ENDPOINT_URL, AWS_REGION, AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY, and AWS_SESSION_TOKEN. Objects are addressed
+// path-style so that S3 compatible servers like MinIO work.
+type s3Folder struct {
+	client      *http.Client
+	endpoint    *url.URL
+	credentials s3Credentials
+	bucket      string
+	prefix      string
+
+	// etags holds the ETags of objects seen in listings keyed by object key.
+	etags sync.Map
+}
+
+// newS3Folder returns the folder at the `s3://` URL `u`.
+func newS3Folder(u *url.URL) *s3Folder {
+	var credentials s3Credentials = s3Credentials{
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		region:       os.Getenv("AWS_REGION"),
+	}
+	if credentials.region == "" {
+		credentials.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if credentials.region == "" {
+		credentials.region = "us-east-1"
+	}
+	var endpoint string = os.Getenv("AWS_ENDPOINT_URL")
+	if endpoint == "" {
+		endpoint = "https://s3." + credentials.region + ".amazonaws.com"
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		endpointURL = &url.URL{Scheme: "https", Host: endpoint}
+	}
+	return &s3Folder{
+		client:      remoteHTTPClient,
+		endpoint:    endpointURL,
+		credentials: credentials,
+		bucket:      u.Host,
+		prefix:      strings.Trim(u.Path, "/"),
+	}
+}
+
+// key returns the object key of `name` in the folder.
+func (f *s3Folder) key(name string) string {
+	return strings.TrimPrefix(path.Join(f.prefix, name), "/")
+}
+
+func (f *s3Folder) Path(name string) string {
+	var key string = f.key(name)
+	if key == "." {
+		key = ""
+	}
+	return "s3://" + f.bucket + "/" + key
+}
+
+// request sends a signed request with method `method` for the object `key`
+// and query `query` and returns the response if its status is one of
+// `expected`. A 404 response is reported as fs.ErrNotExist.
+func (f *s3Folder) request(method, key string, query url.Values, body io.Reader, size int64, expected ...int) (*http.Response, error) {
+	var objectPath string = "/" + f.bucket + "/"
+	if key != "" && key != "." {
+		objectPath += key
+	}
+	var target string = strings.TrimSuffix(f.endpoint.String(), "/") + s3URIEncode(objectPath, false)
+	if len(query) > 0 {
+		target += "?" + s3CanonicalQuery(query)
+	}
+	request, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	var payloadHash string = s3EmptyPayload
+	if body != nil {
+		request.ContentLength = size
+		payloadHash = s3UnsignedPayload
+	}
+	signS3Request(request, f.credentials, payloadHash, time.Now())
+	response, err := f.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range expected {
+		if response.StatusCode == status {
+			return response, nil
+		}
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil, &fs.PathError{Op: strings.ToLower(method), Path: "s3://" + f.bucket + "/" + key, Err: fs.ErrNotExist}
+	}
+	var s3Error struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.NewDecoder(response.Body).Decode(&s3Error) == nil && s3Error.Code != "" {
+		return nil, fmt.Errorf("%s s3://%s/%s failed: %s (%s: %s)", method, f.bucket, key, response.Status, s3Error.Code, s3Error.Message)
+	}
+	return nil, fmt.Errorf("%s s3://%s/%s failed: %s", method, f.bucket, key, response.Status)
+}
+
+type s3ListBucketResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		ETag         string    `xml:"ETag"`
+		Size         int64     `xml:"Size"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+}
+
+// list returns the objects and sub-folders directly in the folder `name`.
+func (f *s3Folder) list(name string) ([]fs.FileInfo, error) {
+	var prefix string = f.key(name)
+	if prefix == "." {
+		prefix = ""
+	}
+	if prefix != "" {
+		prefix += "/"
+	}
+	var infos []fs.FileInfo = []fs.FileInfo{}
+	var continuationToken string
+	for {
+		var query url.Values = url.Values{
+			"list-type": []string{"2"},
+			"prefix":    []string{prefix},
+			"delimiter": []string{"/"},
+		}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+		response, err := f.request(http.MethodGet, "", query, nil, 0, http.StatusOK)
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListBucketResult
+		err = xml.NewDecoder(response.Body).Decode(&result)
+		response.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse listing of %s: %s", f.Path(name), err.Error())
+		}
+		for _, object := range result.Contents {
+			if object.Key == prefix {
+				continue
+			}
+			f.etags.Store(object.Key, object.ETag)
+			infos = append(infos, &remoteFileInfo{
+				name:    strings.TrimPrefix(object.Key, prefix),
+				size:    object.Size,
+				modTime: object.LastModified,
+			})
+		}
+		for _, commonPrefix := range result.CommonPrefixes {
+			infos = append(infos, &remoteFileInfo{
+				name: strings.TrimSuffix(strings.TrimPrefix(commonPrefix.Prefix, prefix), "/"),
+				dir:  true,
+			})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		continuationToken = result.NextContinuationToken
+	}
+	return infos, nil
+}
+
+func (f *s3Folder) ReadDir(name string) ([]fs.DirEntry, error) {
+	infos, err := f.list(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(infos) == 0 {
+		return nil, &fs.PathError{Op: "readdir", Path: f.Path(name), Err: fs.ErrNotExist}
+	}
+	var entries []fs.DirEntry = []fs.DirEntry{}
+	for _, info := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+func (f *s3Folder) Stat(name string) (fs.FileInfo, error) {
+	var key string = f.key(name)
+	if key != "." {
+		response, err := f.request(http.MethodHead, key, nil, nil, 0, http.StatusOK)
+		if err == nil {
+			response.Body.Close()
+			f.etags.Store(key, response.Header.Get("ETag"))
+			var info *remoteFileInfo = &remoteFileInfo{name: path.Base(key), size: response.ContentLength}
+			info.modTime, _ = http.ParseTime(response.Header.Get("Last-Modified"))
+			return info, nil
+		}
+	}
+	infos, err := f.list(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(infos) == 0 && key != "." {
+		return nil, &fs.PathError{Op: "stat", Path: f.Path(name), Err: fs.ErrNotExist}
+	}
+	return &remoteFileInfo{name: path.Base(key), dir: true}, nil
+}
+
+func (f *s3Folder) Open(name string) (fs.File, error) {
+	var key string = f.key(name)
+	response, err := f.request(http.MethodGet, key, nil, nil, 0, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	f.etags.Store(key, response.Header.Get("ETag"))
+	var info *remoteFileInfo = &remoteFileInfo{name: path.Base(key), size: response.ContentLength}
+	info.modTime, _ = http.ParseTime(response.Header.Get("Last-Modified"))
+	return &remoteFile{ReadCloser: response.Body, info: info}, nil
+}
+
+// KnownMd5sum returns the md5 sum of the object `name` from its ETag, which
+// is the md5 sum of the content unless the object was uploaded in multiple
+// parts or is encrypted with a customer key.
+func (f *s3Folder) KnownMd5sum(name string) (string, bool) {
+	var key string = f.key(name)
+	etag, ok := f.etags.Load(key)
+	if !ok {
+		if _, err := f.Stat(name); err != nil {
+			return "", false
+		}
+		etag, ok = f.etags.Load(key)
+		if !ok {
+			return "", false
+		}
+	}
+	var md5sum string = strings.ToLower(strings.Trim(etag.(string), `"`))
+	if len(md5sum) != 32 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(md5sum); err != nil {
+		return "", false
+	}
+	return md5sum, true
+}
+
+// MkdirAll does nothing since S3 has no folders.
+func (f *s3Folder) MkdirAll(name string) error {
+	return nil
+}
+
+func (f *s3Folder) WriteFile(name string, content io.Reader, size int64) error {
+	var key string = f.key(name)
+	f.etags.Delete(key)
+	response, err := f.request(http.MethodPut, key, nil, content, size, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if etag := response.Header.Get("ETag"); etag != "" {
+		f.etags.Store(key, etag)
+	}
+	return nil
+}
+
+func (f *s3Folder) Remove(name string) error {
+	var key string = f.key(name)
+	f.etags.Delete(key)
+	response, err := f.request(http.MethodDelete, key, nil, nil, 0, http.StatusOK, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+// signS3Request signs `request` with AWS signature version 4 using the
+// payload hash `payloadHash`. All headers set on the request are signed.
+func signS3Request(request *http.Request, credentials s3Credentials, payloadHash string, now time.Time) {
+	var amzDate string = now.UTC().Format("20060102T150405Z")
+	var date string = amzDate[:8]
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if credentials.sessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", credentials.sessionToken)
+	}
+
+	var headers map[string]string = map[string]string{"host": request.URL.Host}
+	for key, values := range request.Header {
+		headers[strings.ToLower(key)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	var names []string = []string{}
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	var signedHeaders string = strings.Join(names, ";")
+
+	var canonicalRequest string = strings.Join([]string{
+		request.Method,
+		s3URIEncode(request.URL.Path, false),
+		s3CanonicalQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	var scope string = date + "/" + credentials.region + "/s3/aws4_request"
+	var stringToSign string = "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexSHA256([]byte(canonicalRequest))
+
+	var key []byte = []byte("AWS4" + credentials.secretKey)
+	for _, part := range []string{date, credentials.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	var signature string = hex.EncodeToString(hmacSHA256(key, stringToSign))
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		credentials.accessKey, scope, signedHeaders, signature))
+}
+
+// s3URIEncode percent-encodes `s` as required for AWS signatures; slashes are
+// only encoded if `encodeSlash` is true.
+func s3URIEncode(s string, encodeSlash bool) string {
+	var result strings.Builder
+	for _, b := range []byte(s) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', b == '/' && !encodeSlash:
+			result.WriteByte(b)
+		default:
+			fmt.Fprintf(&result, "%%%02X", b)
+		}
+	}
+	return result.String()
+}
+
+// s3CanonicalQuery returns the query `query` encoded and sorted as required
+// for AWS signatures.
+func s3CanonicalQuery(query url.Values) string {
+	var pairs []string = []string{}
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, s3URIEncode(key, true)+"="+s3URIEncode(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	hash := hmac.New(sha256.New, key)
+	hash.Write([]byte(data))
+	return hash.Sum(nil)
+}
+
+func hexSHA256(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
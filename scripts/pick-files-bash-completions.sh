@@ -5,23 +5,41 @@ _complete_pick_files () {
   local known_options=(
     -N --number
     --append
+    --batch-name-format
     --block-selection
     --config
+    --copy-jobs
     --debug
     --delete-existing
     --destination
+    --destination-format
     --destination-option
     --dry-run
     --dump-configuration
+    --files-from
     --folder
+    --force-clean
     -h --help
+    --html-gallery
     --journald
+    --keep-batches
+    --listen
+    --notify-webhook
+    --output
+    --playlist
+    --playlist-only
+    --playlist-relative
+    --preserve
     --print-database
     --print-database-format
     --print-database-statistics
     --reset-database
+    --schedule
+    --skip-scan
     --suffix
     --verbose
+    --verify
+    --verify-retries
     --version
   )
 
@@ -32,24 +50,42 @@ _complete_pick_files () {
       _filedir
       return
       ;;
+    --destination-format)
+      readarray -t COMPREPLY < <(compgen -W 'dir zip tar tar.gz' -- "${cur}")
+      return
+      ;;
     --destination-option)
-      readarray -t COMPREPLY < <(compgen -W 'panic delete append' -- "${cur}")
+      readarray -t COMPREPLY < <(compgen -W 'panic delete trash append atomic rotate sync' -- "${cur}")
       return
       ;;
-    --folder|--destination)
+    --folder|--destination|--files-from|--playlist)
       _filedir
       return
       ;;
+    --output)
+      readarray -t COMPREPLY < <(compgen -W 'json ndjson paths paths0' -- "${cur}")
+      return
+      ;;
+    --preserve)
+      readarray -t COMPREPLY < <(compgen -W 'mode times xattrs all' -- "${cur}")
+      return
+      ;;
     --print-database-format)
       readarray -t COMPREPLY < <(compgen -W 'CSV JSON YAML' -- "${cur}")
       return
       ;;
+    systemd)
+      readarray -t COMPREPLY < <(compgen -W 'install status uninstall' -- "${cur}")
+      return
+      ;;
   esac
 
   if [[ "$cur" == -* ]]; then
     readarray -t COMPREPLY < <(compgen -W "${known_options[*]}" -- "${cur}" )
     return
   fi
+
+  readarray -t COMPREPLY < <(compgen -W 'daemon serve systemd ui watch' -- "${cur}")
 }
 
 complete -F _complete_pick_files pick-files
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// defaultProfileName is the name under which the options at the top level of
+// the configuration file can be picked through the API.
+const defaultProfileName string = "default"
+
+// defaultListLimit is the number of files and picks returned by the list
+// endpoints unless a limit is given.
+const defaultListLimit int = 20
+
+//go:embed templates/ui
+var uiFiles embed.FS
+
+// server serves the API of `pick-files serve` and the web UI of `pick-files
+// ui`.
+type server struct {
+	// lock serializes the access to the database and the options. It is not
+	// held while picking files, which takes the database lock itself.
+	lock    sync.Mutex
+	options ProgramOptions
+	// picking is held while files are picked so that only one pick runs at a
+	// time.
+	picking sync.Mutex
+	// run picks the files of a profile.
+	run func(ProgramOptions) ([]Pick, error)
+	// thumbnails caches the thumbnails keyed by md5 sum.
+	thumbnails sync.Map
+}
+
+// profileInfo describes a profile in the API.
+type profileInfo struct {
+	Name        string `json:"name"`
+	Schedule    string `json:"schedule,omitempty"`
+	Destination string `json:"destination"`
+}
+
+// servedFile is a file in the API with the URL to fetch its content.
+type servedFile struct {
+	Name       string    `json:"name"`
+	Source     string    `json:"source"`
+	Md5sum     string    `json:"md5sum"`
+	LastPicked time.Time `json:"lastPicked"`
+	PickCount  int       `json:"pickCount"`
+	Banned     bool      `json:"banned"`
+	Favourite  bool      `json:"favourite"`
+	URL        string    `json:"url"`
+}
+
+// pickRun is a past pick in the pick history.
+type pickRun struct {
+	Time  time.Time    `json:"time"`
+	Files []servedFile `json:"files"`
+}
+
+// fileFlags holds the changes to the flags of a file.
+type fileFlags struct {
+	Banned    *bool `json:"banned"`
+	Favourite *bool `json:"favourite"`
+}
+
+// statisticsInfo holds the database statistics in the API.
+type statisticsInfo struct {
+	Entries          int       `json:"entries"`
+	Size             int64     `json:"size"`
+	OldestLastSeen   time.Time `json:"oldestLastSeen"`
+	OldestLastPicked time.Time `json:"oldestLastPicked"`
+}
+
+// newServer returns a server for the profiles in `options`.
+func newServer(options ProgramOptions) *server {
+	return &server{options: options, run: runPicks}
+}
+
+// handler returns the handler of the API.
+func (s *server) handler() http.Handler {
+	var mux *http.ServeMux = http.NewServeMux()
+	mux.HandleFunc("GET /api/profiles", s.listProfiles)
+	mux.HandleFunc("GET /api/profiles/{profile}/picks", s.currentPicks)
+	mux.HandleFunc("POST /api/profiles/{profile}/picks", s.pick)
+	mux.HandleFunc("GET /api/statistics", s.statistics)
+	mux.HandleFunc("GET /api/history", s.history)
+	mux.HandleFunc("GET /api/files", s.listFiles)
+	mux.HandleFunc("GET /api/files/{md5sum}", s.file)
+	mux.HandleFunc("PATCH /api/files/{md5sum}", s.updateFile)
+	mux.HandleFunc("GET /api/files/{md5sum}/thumbnail", s.thumbnail)
+	return mux
+}
+
+// uiHandler returns the handler of the web UI and the API it uses.
+func (s *server) uiHandler() http.Handler {
+	var mux *http.ServeMux = http.NewServeMux()
+	mux.Handle("/api/", s.handler())
+	ui, err := fs.Sub(uiFiles, "templates/ui")
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+	mux.Handle("/", http.FileServerFS(ui))
+	return mux
+}
+
+// newServedFile returns the API representation of `file`.
+func newServedFile(file File) servedFile {
+	return servedFile{
+		Name:       file.Name,
+		Source:     file.Path,
+		Md5sum:     file.Md5sum,
+		LastPicked: file.LastPicked,
+		PickCount:  file.PickCount,
+		Banned:     file.Banned,
+		Favourite:  file.Favourite,
+		URL:        "/api/files/" + file.Md5sum,
+	}
+}
+
+// listLimit returns the limit given in the query of `r`.
+func listLimit(r *http.Request) (int, error) {
+	if r.URL.Query().Get("limit") == "" {
+		return defaultListLimit, nil
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		return 0, errors.New("invalid limit " + r.URL.Query().Get("limit"))
+	}
+	return limit, nil
+}
+
+// writeJSON writes `value` as JSON response with `status`.
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		log.Warn().Msgf("cannot write response: %s", err.Error())
+	}
+}
+
+// writeError writes `err` as JSON response with `status`.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// profile returns the options for picking the profile `name`.
+func (s *server) profile(name string) (ProgramOptions, bool) {
+	if _, ok := s.options.Profiles[name]; ok {
+		// The profiles were checked when the configuration was loaded.
+		options, err := profileOptions(s.options, name)
+		return options, err == nil
+	}
+	if name == defaultProfileName && s.options.hasSources() {
+		return s.options, true
+	}
+	return ProgramOptions{}, false
+}
+
+// listProfiles answers GET /api/profiles with the profiles that can be
+// picked.
+func (s *server) listProfiles(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var profiles []profileInfo = []profileInfo{}
+	if _, ok := s.options.Profiles[defaultProfileName]; !ok && s.options.hasSources() {
+		profiles = append(profiles, profileInfo{Name: defaultProfileName, Destination: s.options.Destination})
+	}
+	for name, profile := range s.options.Profiles {
+		options, _ := s.profile(name)
+		profiles = append(profiles, profileInfo{
+			Name:        name,
+			Schedule:    profile.Schedule,
+			Destination: options.Destination,
+		})
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	writeJSON(w, http.StatusOK, profiles)
+}
+
+// latestPicks returns the files of the last pick from `folders`, or from all
+// files if no folders are given.
+func latestPicks(allFiles Files, folders []string) Files {
+	var latest time.Time
+	var result Files = Files{}
+	for _, file := range allFiles {
+		if file.Removed || file.LastPicked.IsZero() || (len(folders) > 0 && !isUnderFolders(file.Path, folders)) {
+			continue
+		}
+		if file.LastPicked.After(latest) {
+			latest = file.LastPicked
+			result = Files{}
+		}
+		if file.LastPicked.Equal(latest) {
+			result = append(result, file)
+		}
+	}
+	return result
+}
+
+// currentPicks answers GET /api/profiles/{profile}/picks with the files of
+// the last pick of the profile.
+func (s *server) currentPicks(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	options, ok := s.profile(r.PathValue("profile"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("unknown profile "+r.PathValue("profile")))
+		return
+	}
+	var files []servedFile = []servedFile{}
+	for _, file := range latestPicks(loadDB(), options.Folders) {
+		files = append(files, newServedFile(file))
+	}
+	writeJSON(w, http.StatusOK, files)
+}
+
+// pickHistory returns the last `limit` picks of `allFiles`, the latest pick
+// first.
+func pickHistory(allFiles Files, limit int) []pickRun {
+	var runs map[time.Time]*pickRun = map[time.Time]*pickRun{}
+	for _, file := range allFiles {
+		for _, picked := range file.PickHistory {
+			var key time.Time = picked.UTC()
+			if runs[key] == nil {
+				runs[key] = &pickRun{Time: key, Files: []servedFile{}}
+			}
+			runs[key].Files = append(runs[key].Files, newServedFile(file))
+		}
+	}
+	var result []pickRun = []pickRun{}
+	for _, run := range runs {
+		result = append(result, *run)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Time.After(result[j].Time) })
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// history answers GET /api/history with the last picks.
+func (s *server) history(w http.ResponseWriter, r *http.Request) {
+	limit, err := listLimit(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	writeJSON(w, http.StatusOK, pickHistory(loadDB(), limit))
+}
+
+// rankFiles returns the files in `allFiles` matching `filter` in `order`.
+// The filter can be empty, banned, or favourite; banned files are only
+// included with the banned filter. The order can be name, least-picked, or
+// most-picked.
+func rankFiles(allFiles Files, order, filter string) (Files, error) {
+	var files Files = Files{}
+	for _, file := range allFiles {
+		if file.Removed {
+			continue
+		}
+		switch filter {
+		case "":
+			if file.Banned {
+				continue
+			}
+		case "banned":
+			if !file.Banned {
+				continue
+			}
+		case "favourite":
+			if !file.Favourite || file.Banned {
+				continue
+			}
+		default:
+			return nil, errors.New("unknown filter " + filter)
+		}
+		files = append(files, file)
+	}
+	var less func(a, b File) bool
+	switch order {
+	case "", "name":
+		less = func(a, b File) bool { return a.Name < b.Name }
+	case "least-picked":
+		less = func(a, b File) bool {
+			return a.PickCount < b.PickCount || (a.PickCount == b.PickCount && a.LastPicked.Before(b.LastPicked))
+		}
+	case "most-picked":
+		less = func(a, b File) bool {
+			return a.PickCount > b.PickCount || (a.PickCount == b.PickCount && a.LastPicked.After(b.LastPicked))
+		}
+	default:
+		return nil, errors.New("unknown order " + order)
+	}
+	sort.SliceStable(files, func(i, j int) bool { return less(files[i], files[j]) })
+	return files, nil
+}
+
+// listFiles answers GET /api/files with the files in the database. The query
+// parameters order, filter, and limit are described in rankFiles.
+func (s *server) listFiles(w http.ResponseWriter, r *http.Request) {
+	limit, err := listLimit(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	files, err := rankFiles(loadDB(), r.URL.Query().Get("order"), r.URL.Query().Get("filter"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var result []servedFile = []servedFile{}
+	for _, file := range files {
+		if len(result) == limit {
+			break
+		}
+		result = append(result, newServedFile(file))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// updateFile answers PATCH /api/files/{md5sum} by changing the banned and
+// favourite flags of the file. Banned files are not picked anymore and
+// favourites are picked more often.
+func (s *server) updateFile(w http.ResponseWriter, r *http.Request) {
+	var flags fileFlags
+	err := json.NewDecoder(r.Body).Decode(&flags)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var updated *File
+	updateDB(func(allFiles Files) Files {
+		for i := range allFiles {
+			if allFiles[i].Md5sum != r.PathValue("md5sum") {
+				continue
+			}
+			if flags.Banned != nil {
+				allFiles[i].Banned = *flags.Banned
+			}
+			if flags.Favourite != nil {
+				allFiles[i].Favourite = *flags.Favourite
+			}
+			var file File = allFiles[i]
+			updated = &file
+		}
+		return allFiles
+	})
+	if updated == nil {
+		writeError(w, http.StatusNotFound, errors.New("unknown file "+r.PathValue("md5sum")))
+		return
+	}
+	log.Info().Msgf("updated %s: banned %t, favourite %t", updated.Path, updated.Banned, updated.Favourite)
+	writeJSON(w, http.StatusOK, newServedFile(*updated))
+}
+
+// pick answers POST /api/profiles/{profile}/picks by picking files for the
+// profile and returns the picks. Only one pick runs at a time; further
+// requests are answered with 409 Conflict while it is running.
+func (s *server) pick(w http.ResponseWriter, r *http.Request) {
+	// Requiring JSON makes browsers ask before sending the request from
+	// another site, so that web pages cannot trigger picks.
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, errors.New("picking files requires Content-Type application/json"))
+		return
+	}
+	if !s.picking.TryLock() {
+		writeError(w, http.StatusConflict, errors.New("files are being picked already"))
+		return
+	}
+	defer s.picking.Unlock()
+	s.lock.Lock()
+	options, ok := s.profile(r.PathValue("profile"))
+	s.lock.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("unknown profile "+r.PathValue("profile")))
+		return
+	}
+	if !options.hasSources() {
+		writeError(w, http.StatusBadRequest, errors.New("profile "+r.PathValue("profile")+" has no folders"))
+		return
+	}
+	log.Info().Msgf("picking files for profile %s", r.PathValue("profile"))
+	picks, err := s.run(options)
+	if err != nil {
+		log.Error().Msgf("picking files for profile %s failed: %s", r.PathValue("profile"), err.Error())
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, picks)
+}
+
+// statistics answers GET /api/statistics with the database statistics.
+func (s *server) statistics(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var statistics DatabaseStatistics = getDatabaseStatistics(loadDB())
+	writeJSON(w, http.StatusOK, statisticsInfo{
+		Entries:          statistics.NumberEntries,
+		Size:             statistics.dbSize,
+		OldestLastSeen:   statistics.oldestLastSeen,
+		OldestLastPicked: statistics.oldestLastPicked,
+	})
+}
+
+// findFile returns the database record of the file with `md5sum`.
+func (s *server) findFile(md5sum string) (File, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, file := range loadDB() {
+		if file.Md5sum == md5sum && !file.Removed {
+			return file, true
+		}
+	}
+	return File{}, false
+}
+
+// thumbnail answers GET /api/files/{md5sum}/thumbnail with a JPEG thumbnail
+// of the image.
+func (s *server) thumbnail(w http.ResponseWriter, r *http.Request) {
+	file, ok := s.findFile(r.PathValue("md5sum"))
+	if !ok || !isImage(file.Name) {
+		writeError(w, http.StatusNotFound, errors.New("no thumbnail of "+r.PathValue("md5sum")))
+		return
+	}
+	thumbnail, ok := s.thumbnails.Load(file.Md5sum)
+	if !ok {
+		var err error
+		thumbnail, err = makeThumbnail(file.Path, thumbnailSize)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		s.thumbnails.Store(file.Md5sum, thumbnail)
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	// The content of a file never changes for its md5 sum.
+	w.Header().Set("Cache-Control", "max-age=86400")
+	w.Write(thumbnail.([]byte))
+}
+
+// file answers GET /api/files/{md5sum} with the content of the file. Only
+// files recorded in the database are served.
+func (s *server) file(w http.ResponseWriter, r *http.Request) {
+	file, ok := s.findFile(r.PathValue("md5sum"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("unknown file "+r.PathValue("md5sum")))
+		return
+	}
+	f, info, err := openSourceFile(sourceOf(file.Path))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			writeError(w, http.StatusNotFound, err)
+		} else {
+			writeError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	defer f.Close()
+	if contentType := mime.TypeByExtension(path.Ext(file.Name)); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	if seeker, ok := f.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, file.Name, info.ModTime(), seeker)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	_, err = io.Copy(w, f)
+	if err != nil {
+		log.Warn().Msgf("cannot send %s: %s", file.Path, err.Error())
+	}
+}
+
+// reload reads the configuration file again.
+func (s *server) reload() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	log.Info().Msgf("reloading configuration file %s", s.options.configurationFile)
+	options, err := reloadConfiguration(s.options)
+	if err != nil {
+		log.Error().Msgf("keeping current configuration: %s", err.Error())
+		return
+	}
+	s.options = options
+}
+
+// runServer runs `pick-files serve`, or `pick-files ui` if `withUI` is true:
+// it serves the API, and the web UI, on `options.listen` until it is stopped.
+// SIGHUP reloads the configuration file.
+func runServer(options ProgramOptions, withUI bool) {
+	var s *server = newServer(options)
+	var handler http.Handler = s.handler()
+	if withUI {
+		handler = s.uiHandler()
+	}
+	var httpServer *http.Server = &http.Server{
+		Addr:              options.listen,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	var signals chan os.Signal = make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	var stopped chan struct{} = make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for received := range signals {
+			if received == syscall.SIGHUP {
+				s.reload()
+				continue
+			}
+			log.Info().Msgf("received %s, stopping", received.String())
+			// Let a pick in progress finish.
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			httpServer.Shutdown(ctx)
+			return
+		}
+	}()
+	if withUI {
+		log.Info().Msgf("serving the web UI on %s", options.listen)
+	} else {
+		log.Info().Msgf("serving the API on %s", options.listen)
+	}
+	err := httpServer.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal().Msg(err.Error())
+	}
+	<-stopped
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	var tempDir string = t.TempDir()
+	t.Setenv("SNAP_USER_DATA", tempDir)
+	var photos string = path.Join(tempDir, "photos")
+	if err := os.Mkdir(photos, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"a.jpg": "a", "b.jpg": "b", "c.jpg": "c"} {
+		if err := os.WriteFile(path.Join(photos, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var options ProgramOptions = ProgramOptions{
+		dbExpirationAge:   time.Hour,
+		DestinationOption: DELETE,
+		Folders:           Folders{photos},
+		NumberOfFiles:     2,
+		Profiles: map[string]Profile{
+			"frame": {Schedule: "@daily", Options: ProgramOptions{
+				Destination:       path.Join(tempDir, "frame"),
+				DestinationOption: UNSET,
+			}},
+			"empty": {Options: ProgramOptions{DestinationOption: UNSET}},
+		},
+	}
+	server := httptest.NewServer(newServer(options).handler())
+	t.Cleanup(server.Close)
+
+	// request sends a request and decodes the JSON response into `result`.
+	request := func(method, url string, expectedStatus int, result any) {
+		t.Helper()
+		r, err := http.NewRequest(method, server.URL+url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Content-Type", "application/json")
+		response, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		if response.StatusCode != expectedStatus {
+			body, _ := io.ReadAll(response.Body)
+			t.Fatalf("expected status %d for %s %s but got %d: %s", expectedStatus, method, url, response.StatusCode, body)
+		}
+		if result != nil {
+			if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var profiles []profileInfo
+	request(http.MethodGet, "/api/profiles", http.StatusOK, &profiles)
+	if len(profiles) != 3 || profiles[0].Name != "default" || profiles[2].Name != "frame" || profiles[2].Schedule != "@daily" {
+		t.Errorf("unexpected profiles %v", profiles)
+	}
+
+	var picks []Pick
+	request(http.MethodPost, "/api/profiles/frame/picks", http.StatusOK, &picks)
+	if len(picks) != 2 || !strings.HasPrefix(picks[0].Destination, path.Join(tempDir, "frame")) {
+		t.Fatalf("expected 2 picks copied into the frame folder but got %v", picks)
+	}
+
+	var current []servedFile
+	request(http.MethodGet, "/api/profiles/frame/picks", http.StatusOK, &current)
+	if len(current) != 2 {
+		t.Fatalf("expected 2 current picks but got %v", current)
+	}
+	var picked map[string]bool = map[string]bool{picks[0].Md5sum: true, picks[1].Md5sum: true}
+	for _, file := range current {
+		if !picked[file.Md5sum] {
+			t.Errorf("unexpected current pick %v", file)
+		}
+	}
+
+	response, err := http.Get(server.URL + current[0].URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || string(content) != strings.TrimSuffix(current[0].Name, ".jpg") {
+		t.Errorf("unexpected response %d %q for %s", response.StatusCode, content, current[0].Name)
+	}
+	if response.Header.Get("Content-Type") != "image/jpeg" {
+		t.Errorf("expected image/jpeg but got %s", response.Header.Get("Content-Type"))
+	}
+
+	var statistics statisticsInfo
+	request(http.MethodGet, "/api/statistics", http.StatusOK, &statistics)
+	if statistics.Entries != 3 {
+		t.Errorf("expected 3 database entries but got %d", statistics.Entries)
+	}
+
+	request(http.MethodGet, "/api/files/0123456789abcdef0123456789abcdef", http.StatusNotFound, nil)
+	request(http.MethodPost, "/api/profiles/unknown/picks", http.StatusNotFound, nil)
+	request(http.MethodGet, "/api/profiles/frame", http.StatusNotFound, nil)
+	request(http.MethodDelete, "/api/profiles/frame/picks", http.StatusMethodNotAllowed, nil)
+
+	// A plain text request, as a cross-site form can send it, is refused.
+	response, err = http.Post(server.URL+"/api/profiles/frame/picks", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("expected status 415 for a plain text request but got %d", response.StatusCode)
+	}
+}
+
+func TestServerPickInProgress(t *testing.T) {
+	t.Setenv("SNAP_USER_DATA", t.TempDir())
+	var s *server = newServer(ProgramOptions{Folders: Folders{t.TempDir()}, NumberOfFiles: 1})
+	var started chan struct{} = make(chan struct{})
+	var release chan struct{} = make(chan struct{})
+	s.run = func(options ProgramOptions) ([]Pick, error) {
+		close(started)
+		<-release
+		return []Pick{}, nil
+	}
+	server := httptest.NewServer(s.handler())
+	t.Cleanup(server.Close)
+
+	// pick requests a pick of the default profile and returns the status.
+	pick := func() int {
+		response, err := http.Post(server.URL+"/api/profiles/default/picks", "application/json", nil)
+		if err != nil {
+			t.Error(err)
+			return 0
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+	var status chan int = make(chan int, 1)
+	go func() { status <- pick() }()
+	<-started
+
+	// Other requests are answered while the pick is running.
+	var client *http.Client = &http.Client{Timeout: 5 * time.Second}
+	for _, url := range []string{"/api/profiles", "/api/statistics", "/api/files"} {
+		response, err := client.Get(server.URL + url)
+		if err != nil {
+			t.Fatalf("expected %s to be answered during a pick: %s", url, err.Error())
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			t.Errorf("expected status 200 for %s during a pick but got %d", url, response.StatusCode)
+		}
+	}
+	if second := pick(); second != http.StatusConflict {
+		t.Errorf("expected status 409 for a second pick but got %d", second)
+	}
+
+	close(release)
+	if first := <-status; first != http.StatusOK {
+		t.Errorf("expected status 200 for the first pick but got %d", first)
+	}
+}
+
+func TestUI(t *testing.T) {
+	var tempDir string = t.TempDir()
+	t.Setenv("SNAP_USER_DATA", tempDir)
+	var photo string = path.Join(tempDir, "photo.png")
+	var img *image.RGBA = image.NewRGBA(image.Rect(0, 0, 640, 480))
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(photo, encoded.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var first time.Time = time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC)
+	var second time.Time = first.Add(24 * time.Hour)
+	var now time.Time = time.Now()
+	storeDB(Files{
+		{Name: "photo.png", Path: photo, Md5sum: "photo", LastSeen: now, LastPicked: second, PickCount: 2, PickHistory: []time.Time{first, second}},
+		{Name: "a.jpg", Path: path.Join(tempDir, "a.jpg"), Md5sum: "a", LastSeen: now, LastPicked: first, PickCount: 1, PickHistory: []time.Time{first}},
+		{Name: "b.jpg", Path: path.Join(tempDir, "b.jpg"), Md5sum: "b", LastSeen: now},
+	})
+	server := httptest.NewServer(newServer(ProgramOptions{}).uiHandler())
+	t.Cleanup(server.Close)
+
+	// get fetches `url` and returns the response body.
+	get := func(url string) []byte {
+		t.Helper()
+		response, err := http.Get(server.URL + url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		content, _ := io.ReadAll(response.Body)
+		if response.StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200 for %s but got %d: %s", url, response.StatusCode, content)
+		}
+		return content
+	}
+
+	if !strings.Contains(string(get("/")), "<script src=\"ui.js\">") {
+		t.Errorf("expected the UI page")
+	}
+	get("/ui.js")
+
+	var history []pickRun
+	if err := json.Unmarshal(get("/api/history"), &history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || !history[0].Time.Equal(second) || len(history[0].Files) != 1 || len(history[1].Files) != 2 {
+		t.Errorf("unexpected history %v", history)
+	}
+
+	var files []servedFile
+	if err := json.Unmarshal(get("/api/files?order=most-picked&limit=2"), &files); err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].Md5sum != "photo" || files[1].Md5sum != "a" {
+		t.Errorf("unexpected most picked files %v", files)
+	}
+
+	request, err := http.NewRequest(http.MethodPatch, server.URL+"/api/files/b", strings.NewReader(`{"banned": true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200 banning b.jpg but got %d", response.StatusCode)
+	}
+	if err := json.Unmarshal(get("/api/files?order=least-picked"), &files); err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].Md5sum != "a" {
+		t.Errorf("expected banned b.jpg not to be listed but got %v", files)
+	}
+	if err := json.Unmarshal(get("/api/files?filter=banned"), &files); err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Md5sum != "b" || !files[0].Banned {
+		t.Errorf("expected b.jpg to be banned but got %v", files)
+	}
+
+	config, err := jpeg.DecodeConfig(bytes.NewReader(get("/api/files/photo/thumbnail")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Width != thumbnailSize || config.Height != thumbnailSize*480/640 {
+		t.Errorf("unexpected thumbnail size %dx%d", config.Width, config.Height)
+	}
+}
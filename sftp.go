@@ -0,0 +1,307 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/pkg/sftp"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshKeyVariable is the environment variable naming the private key used for
+// SFTP connections instead of the default keys in ~/.ssh.
+const sshKeyVariable string = "PICK_FILES_SSH_KEY"
+
+// sshKnownHostsVariable is the environment variable naming the known_hosts
+// file used to verify SFTP servers instead of ~/.ssh/known_hosts.
+const sshKnownHostsVariable string = "PICK_FILES_SSH_KNOWN_HOSTS"
+
+// sftpClients holds the open SFTP connections keyed by user and address so
+// that all files on a server share one connection. Connections are removed
+// once they are closed, e.g. because the server went away or the connection
+// was idle for longer than remoteIOTimeout, so that the next use connects
+// again.
+var sftpClients = struct {
+	sync.Mutex
+	clients map[string]*sftp.Client
+}{clients: map[string]*sftp.Client{}}
+
+// sftpFolder is a folder on an SFTP server given by a URL of the form
+// `sftp://user@host:port/path`.
+type sftpFolder struct {
+	user    string
+	address string
+	root    string
+	display *url.URL
+}
+
+// newSFTPFolder returns the folder at the `sftp://` URL `u`. The connection is
+// made when the folder is first used.
+func newSFTPFolder(u *url.URL) *sftpFolder {
+	var address string = u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), "22")
+	}
+	var user string = u.User.Username()
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+	var root string = u.Path
+	if root == "" {
+		root = "."
+	}
+	return &sftpFolder{user: user, address: address, root: root, display: redactedURL(u)}
+}
+
+// client returns the SFTP client for the server of the folder, connecting on
+// first use and again after the connection was lost.
+func (f *sftpFolder) client() (*sftp.Client, error) {
+	sftpClients.Lock()
+	defer sftpClients.Unlock()
+	var key string = f.user + "@" + f.address
+	if client, ok := sftpClients.clients[key]; ok {
+		return client, nil
+	}
+	config, agentConnection, err := sshClientConfig(f.user)
+	if err != nil {
+		return nil, err
+	}
+	connection, err := dialSSH(f.address, config)
+	if agentConnection != nil {
+		// The agent is only needed for authentication.
+		agentConnection.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to %s: %s", f.address, err.Error())
+	}
+	client, err := sftp.NewClient(connection)
+	if err != nil {
+		connection.Close()
+		return nil, fmt.Errorf("cannot start SFTP session on %s: %s", f.address, err.Error())
+	}
+	sftpClients.clients[key] = client
+	go func() {
+		err := client.Wait()
+		sftpClients.Lock()
+		if sftpClients.clients[key] == client {
+			delete(sftpClients.clients, key)
+		}
+		sftpClients.Unlock()
+		connection.Close()
+		log.Debug().Msgf("closed SFTP connection to %s: %v", f.address, err)
+	}()
+	return client, nil
+}
+
+// dialSSH connects to the SSH server at `address`. Every read and write on the
+// connection, including the handshake, fails if the server does not respond
+// within remoteIOTimeout.
+func dialSSH(address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := net.DialTimeout("tcp", address, config.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	c, channels, requests, err := ssh.NewClientConn(&idleTimeoutConn{Conn: conn, timeout: remoteIOTimeout}, address, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, channels, requests), nil
+}
+
+// releaseClient closes `client` if `err` shows that its connection was lost.
+// The connection is then removed from sftpClients so that the next use
+// connects again.
+func releaseClient(client *sftp.Client, err error) {
+	if errors.Is(err, sftp.ErrSSHFxConnectionLost) {
+		client.Close()
+	}
+}
+
+// sshClientConfig returns the SSH configuration for `user` authenticating
+// with the keys of a running SSH agent and the private key files, and
+// verifying the server against the known_hosts file. The returned connection
+// to the SSH agent, if any, has to be closed once the client authenticated.
+func sshClientConfig(user string) (*ssh.ClientConfig, net.Conn, error) {
+	home, _ := os.UserHomeDir()
+	var knownHostsFile string = os.Getenv(sshKnownHostsVariable)
+	if knownHostsFile == "" {
+		knownHostsFile = path.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read known hosts from %s: %s", knownHostsFile, err.Error())
+	}
+
+	var methods []ssh.AuthMethod = []ssh.AuthMethod{}
+	var agentConnection net.Conn
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		if connection, err := net.Dial("unix", socket); err == nil {
+			agentConnection = connection
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(connection).Signers))
+		}
+	}
+	var keyFiles []string = []string{os.Getenv(sshKeyVariable)}
+	if keyFiles[0] == "" {
+		keyFiles = []string{
+			path.Join(home, ".ssh", "id_ed25519"),
+			path.Join(home, ".ssh", "id_ecdsa"),
+			path.Join(home, ".ssh", "id_rsa"),
+		}
+	}
+	var signers []ssh.Signer = []ssh.Signer{}
+	for _, keyFile := range keyFiles {
+		encoded, err := os.ReadFile(keyFile)
+		if err != nil {
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(encoded)
+		if err != nil {
+			var passphraseError *ssh.PassphraseMissingError
+			if !errors.As(err, &passphraseError) {
+				if agentConnection != nil {
+					agentConnection.Close()
+				}
+				return nil, nil, fmt.Errorf("cannot parse private key %s: %s", keyFile, err.Error())
+			}
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	if len(methods) == 0 {
+		return nil, nil, errors.New("no SSH agent or usable private key found for SFTP")
+	}
+	return &ssh.ClientConfig{
+		User:            user,
+		Auth:            methods,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         remoteIOTimeout,
+	}, agentConnection, nil
+}
+
+// remotePath returns the path of `name` on the server.
+func (f *sftpFolder) remotePath(name string) string {
+	return path.Join(f.root, name)
+}
+
+func (f *sftpFolder) Path(name string) string {
+	var result url.URL = *f.display
+	result.Path = path.Join(f.display.Path, name)
+	result.RawPath = ""
+	return result.String()
+}
+
+func (f *sftpFolder) Open(name string) (fs.File, error) {
+	client, err := f.client()
+	if err != nil {
+		return nil, err
+	}
+	file, err := client.Open(f.remotePath(name))
+	if err != nil {
+		releaseClient(client, err)
+		return nil, &fs.PathError{Op: "open", Path: f.Path(name), Err: sftpError(err)}
+	}
+	return file, nil
+}
+
+func (f *sftpFolder) Stat(name string) (fs.FileInfo, error) {
+	client, err := f.client()
+	if err != nil {
+		return nil, err
+	}
+	info, err := client.Stat(f.remotePath(name))
+	if err != nil {
+		releaseClient(client, err)
+		return nil, &fs.PathError{Op: "stat", Path: f.Path(name), Err: sftpError(err)}
+	}
+	return info, nil
+}
+
+func (f *sftpFolder) ReadDir(name string) ([]fs.DirEntry, error) {
+	client, err := f.client()
+	if err != nil {
+		return nil, err
+	}
+	infos, err := client.ReadDir(f.remotePath(name))
+	if err != nil {
+		releaseClient(client, err)
+		return nil, &fs.PathError{Op: "readdir", Path: f.Path(name), Err: sftpError(err)}
+	}
+	var entries []fs.DirEntry = []fs.DirEntry{}
+	for _, info := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+func (f *sftpFolder) MkdirAll(name string) error {
+	client, err := f.client()
+	if err != nil {
+		return err
+	}
+	err = client.MkdirAll(f.remotePath(name))
+	releaseClient(client, err)
+	return err
+}
+
+func (f *sftpFolder) WriteFile(name string, content io.Reader, size int64) error {
+	client, err := f.client()
+	if err != nil {
+		return err
+	}
+	file, err := client.Create(f.remotePath(name))
+	if err != nil {
+		releaseClient(client, err)
+		return err
+	}
+	_, err = file.ReadFrom(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	releaseClient(client, err)
+	return err
+}
+
+func (f *sftpFolder) Remove(name string) error {
+	client, err := f.client()
+	if err != nil {
+		return err
+	}
+	err = client.Remove(f.remotePath(name))
+	releaseClient(client, err)
+	return err
+}
+
+// sftpError maps SFTP status errors to the corresponding fs errors.
+func sftpError(err error) error {
+	var status *sftp.StatusError
+	if errors.As(err, &status) {
+		switch status.FxCode() {
+		case sftp.ErrSSHFxNoSuchFile:
+			return fs.ErrNotExist
+		case sftp.ErrSSHFxPermissionDenied:
+			return fs.ErrPermission
+		}
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return fs.ErrNotExist
+	}
+	return err
+}
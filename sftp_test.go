@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// stallingConn is a server connection that stops sending once `stalled` is
+// closed, simulating a server that stops responding, until `released` is
+// closed.
+type stallingConn struct {
+	net.Conn
+	stalled  chan struct{}
+	released chan struct{}
+}
+
+func (c *stallingConn) Write(b []byte) (int, error) {
+	select {
+	case <-c.stalled:
+		<-c.released
+		return 0, net.ErrClosed
+	default:
+	}
+	return c.Conn.Write(b)
+}
+
+// newSFTPServer starts an SFTP server on a local port accepting the public
+// key of `clientKey` and returns its address, a function dropping all open
+// connections, and a function making the server stop responding.
+func newSFTPServer(t *testing.T, hostKey ssh.Signer, clientKey ssh.PublicKey) (string, func(), func()) {
+	var config *ssh.ServerConfig = &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "user" && bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	config.AddHostKey(hostKey)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	var lock sync.Mutex
+	var conns []net.Conn = []net.Conn{}
+	var stalled chan struct{} = make(chan struct{})
+	var released chan struct{} = make(chan struct{})
+	t.Cleanup(func() { close(released) })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			lock.Lock()
+			conns = append(conns, conn)
+			lock.Unlock()
+			go serveSFTP(&stallingConn{Conn: conn, stalled: stalled, released: released}, config)
+		}
+	}()
+	drop := func() {
+		lock.Lock()
+		defer lock.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+		conns = []net.Conn{}
+	}
+	t.Cleanup(drop)
+	stall := func() { close(stalled) }
+	return listener.Addr().String(), drop, stall
+}
+
+// useSFTPServer starts an SFTP server with newSFTPServer and sets up the
+// client key and known hosts for connecting to it as `user`.
+func useSFTPServer(t *testing.T) (string, func(), func()) {
+	_, hostPrivateKey, _ := ed25519.GenerateKey(rand.Reader)
+	hostKey, err := ssh.NewSignerFromKey(hostPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientPublicKey, clientPrivateKey, _ := ed25519.GenerateKey(rand.Reader)
+	sshClientKey, err := ssh.NewPublicKey(clientPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, drop, stall := newSFTPServer(t, hostKey, sshClientKey)
+
+	var tempDir string = t.TempDir()
+	block, err := ssh.MarshalPrivateKey(clientPrivateKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keyFile string = path.Join(tempDir, "id_ed25519")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var knownHostsFile string = path.Join(tempDir, "known_hosts")
+	var knownHosts string = knownhosts.Line([]string{knownhosts.Normalize(address)}, hostKey.PublicKey()) + "\n"
+	if err := os.WriteFile(knownHostsFile, []byte(knownHosts), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SSH_AUTH_SOCK", "")
+	t.Setenv(sshKeyVariable, keyFile)
+	t.Setenv(sshKnownHostsVariable, knownHostsFile)
+	return address, drop, stall
+}
+
+// serveSFTP serves the SFTP subsystem on the SSH connection `conn`.
+func serveSFTP(conn net.Conn, config *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for request := range requests {
+				request.Reply(request.Type == "subsystem" && string(request.Payload[4:]) == "sftp", nil)
+			}
+		}()
+		server, err := sftp.NewServer(channel)
+		if err != nil {
+			return
+		}
+		go func() {
+			server.Serve()
+			server.Close()
+		}()
+	}
+}
+
+func TestSFTP(t *testing.T) {
+	address, drop, _ := useSFTPServer(t)
+
+	var tempDir string = t.TempDir()
+	var serverFolder string = path.Join(tempDir, "nas")
+	for _, name := range []string{"photos/a.jpg", "photos/2020/b.jpg"} {
+		if err := os.MkdirAll(path.Join(serverFolder, path.Dir(name)), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path.Join(serverFolder, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var base string = "sftp://user@" + address + serverFolder
+
+	files, err := getFilesFromFolders([]string{base + "/photos"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string = []string{}
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	var expectedPaths []string = []string{base + "/photos/2020/b.jpg", base + "/photos/a.jpg"}
+	if strings.Join(paths, ",") != strings.Join(expectedPaths, ",") {
+		t.Fatalf("expected %s but got %s", strings.Join(expectedPaths, ","), strings.Join(paths, ","))
+	}
+	md5sum, err := md5sumFile(path.Join(serverFolder, "photos/2020/b.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files[0].Md5sum != md5sum {
+		t.Errorf("expected md5 sum %s for %s but got %s", md5sum, files[0].Path, files[0].Md5sum)
+	}
+
+	var options ProgramOptions = ProgramOptions{
+		Destination: path.Join(tempDir, "output"),
+		Preserve:    PreserveAttributes{Mode: true, Times: true},
+		Verify:      true,
+	}
+	if _, err := placePickedFiles(options, files); err != nil {
+		t.Fatalf("unexpected error copying from %s: %s", base, err.Error())
+	}
+	if content, _ := os.ReadFile(path.Join(options.Destination, "a.jpg")); string(content) != "photos/a.jpg" {
+		t.Errorf("unexpected content %q of copied a.jpg", content)
+	}
+
+	if _, err := copyFile(base+"/photos/missing.jpg", path.Join(tempDir, "missing.jpg"), PreserveAttributes{}); err == nil {
+		t.Errorf("expected error copying missing file")
+	}
+
+	// A lost connection is replaced by a new one.
+	drop()
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		sftpClients.Lock()
+		_, connected := sftpClients.clients["user@"+address]
+		sftpClients.Unlock()
+		if !connected {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("expected the lost connection to be removed")
+		}
+	}
+	files, err = getFilesFromFolders([]string{base + "/photos"})
+	if err != nil {
+		t.Fatalf("unexpected error after reconnecting: %s", err.Error())
+	}
+	if len(files) != 2 {
+		t.Errorf("expected 2 files after reconnecting but got %d", len(files))
+	}
+}
+
+func TestSFTPTimeout(t *testing.T) {
+	address, _, stall := useSFTPServer(t)
+	var serverFolder string = t.TempDir()
+	if err := os.WriteFile(path.Join(serverFolder, "a.jpg"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var base string = "sftp://user@" + address + serverFolder
+	var timeout time.Duration = remoteIOTimeout
+	remoteIOTimeout = 500 * time.Millisecond
+	t.Cleanup(func() { remoteIOTimeout = timeout })
+	if _, err := getFilesFromFolders([]string{base}); err != nil {
+		t.Fatal(err)
+	}
+	stall()
+
+	var result chan error = make(chan error, 1)
+	go func() {
+		_, err := getFilesFromFolders([]string{base})
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Errorf("expected error from a stalled server")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected a stalled server to time out")
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Source is a tree of candidate files. Names passed to the fs.FS methods are
+// relative to the root of the source; Path maps them to the path recorded in
+// the database.
+type Source interface {
+	fs.FS
+	// Path returns the path of the file `name` in the source.
+	Path(name string) string
+}
+
+// md5Source is implemented by Sources that can tell the md5 sum of some of
+// their files without reading them, e.g. from object storage ETags.
+type md5Source interface {
+	// KnownMd5sum returns the md5 sum of the file `name` and whether it is
+	// known.
+	KnownMd5sum(name string) (string, bool)
+}
+
+// osSource is a Source backed by a folder in the local file system.
+type osSource struct {
+	fs.FS
+	root string
+}
+
+// newOSSource returns a Source for the local folder `root`.
+func newOSSource(root string) *osSource {
+	return &osSource{FS: os.DirFS(root), root: root}
+}
+
+func (s *osSource) Path(name string) string {
+	return path.Join(s.root, name)
+}
+
+// sourceOf returns the Source holding the file at `filename` and the name of
+// the file in that Source.
+func sourceOf(filename string) (Source, string) {
+	if u, ok := remoteURL(filename); ok {
+		return remoteSourceOf(u)
+	}
+	if _, err := os.Stat(filename); err != nil {
+		if archive, member, ok := splitArchiveMemberPath(filename); ok {
+			return newArchiveSource(archive), member
+		}
+	}
+	return newOSSource(path.Dir(filename)), path.Base(filename)
+}
+
+// openSourceFile opens the regular file `name` in `source` for reading and
+// returns its metadata.
+func openSourceFile(source Source, name string) (fs.File, fs.FileInfo, error) {
+	file, err := source.Open(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, fmt.Errorf("source file %s does not exist", source.Path(name))
+		}
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if !info.Mode().IsRegular() {
+		file.Close()
+		return nil, nil, fmt.Errorf("%s is not a regular file", source.Path(name))
+	}
+	return file, info, nil
+}
+
+// newFileFromSource returns a new File for the file `name` in `source` with
+// its md5 sum computed.
+func newFileFromSource(source Source, name string) (File, error) {
+	md5sum, err := sourceMd5sum(source, name)
+	if err != nil {
+		return File{}, err
+	}
+	return File{
+		Name:     path.Base(name),
+		Path:     source.Path(name),
+		Md5sum:   md5sum,
+		LastSeen: time.Now().UTC(),
+	}, nil
+}
+
+// sourceMd5sum returns the md5 sum of the file `name` in `source`, reading
+// the file only if the source does not know the md5 sum already.
+func sourceMd5sum(source Source, name string) (string, error) {
+	if knownSource, ok := source.(md5Source); ok {
+		if md5sum, ok := knownSource.KnownMd5sum(name); ok {
+			return md5sum, nil
+		}
+	}
+	file, _, err := openSourceFile(source, name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	md5sum, err := md5sumReader(file)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %s", source.Path(name), err.Error())
+	}
+	return md5sum, nil
+}
+
+// getFilesFromSource recursively reads all regular files in `source`. Files
+// that cannot be read are skipped with a warning.
+func getFilesFromSource(source Source) (Files, error) {
+	var files Files = Files{}
+	err := fs.WalkDir(source, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		file, err := newFileFromSource(source, name)
+		if err != nil {
+			log.Warn().Msg(err.Error())
+			return nil
+		}
+		files = append(files, file)
+		return nil
+	})
+	return files, err
+}
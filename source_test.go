@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+	"testing/fstest"
+)
+
+// mapSource is an in-memory Source for testing.
+type mapSource struct {
+	fstest.MapFS
+}
+
+func (s mapSource) Path(name string) string {
+	return path.Join("memory", name)
+}
+
+func TestGetFilesFromSource(t *testing.T) {
+	var source mapSource = mapSource{fstest.MapFS{
+		"a.jpg":          {Data: []byte("a"), Mode: 0600},
+		"folder/b.jpg":   {Data: []byte("b"), Mode: 0600},
+		"folder/c/d.jpg": {Data: []byte("d"), Mode: 0600},
+	}}
+	files, err := getFilesFromSource(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expectedPaths []string = []string{"memory/a.jpg", "memory/folder/b.jpg", "memory/folder/c/d.jpg"}
+	if len(files) != len(expectedPaths) {
+		t.Fatalf("expected %d files but got %d", len(expectedPaths), len(files))
+	}
+	for i, file := range files {
+		if file.Path != expectedPaths[i] || file.Name != path.Base(expectedPaths[i]) {
+			t.Errorf("expected %s but got %s", expectedPaths[i], file.Path)
+		}
+	}
+	if files[0].Md5sum != "0cc175b9c0f1b6a831c399e269772661" {
+		t.Errorf("unexpected md5 sum %s for a.jpg", files[0].Md5sum)
+	}
+
+	var dst string = path.Join(t.TempDir(), "b.jpg")
+	nBytes, err := copyFileFromSource(source, "folder/b.jpg", dst, PreserveAttributes{Mode: true, Xattrs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(dst)
+	if err != nil || nBytes != 1 || string(content) != "b" {
+		t.Errorf("expected copy of folder/b.jpg but got %q (%v)", content, err)
+	}
+	if info, err := os.Stat(dst); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600 to be preserved")
+	}
+	if _, err := copyFileFromSource(source, "folder", dst+".folder", PreserveAttributes{}); err == nil {
+		t.Errorf("expected error copying a folder")
+	}
+}
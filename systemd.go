@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/rs/zerolog/log"
+)
+
+// systemdServiceName and systemdTimerName are the names of the user units
+// installed by `pick-files systemd install`.
+const systemdServiceName string = "pick-files.service"
+const systemdTimerName string = "pick-files.timer"
+
+// systemdUnitMarker is the first line of the generated units. Units without
+// it were not written by pick-files and are never overwritten or removed.
+const systemdUnitMarker string = "# Generated by pick-files systemd install"
+
+// defaultSystemdSchedule is the default OnCalendar expression of the timer.
+const defaultSystemdSchedule string = "*-*-* 11:00:00"
+
+// systemdActions lists the actions of the systemd command.
+var systemdActions []string = []string{"install", "status", "uninstall"}
+
+// systemctlCommand is the command used to manage the user units.
+var systemctlCommand []string = []string{"systemctl", "--user"}
+
+//go:embed templates/pick-files.service
+var systemdServiceTemplateSource string
+
+//go:embed templates/pick-files.timer
+var systemdTimerTemplateSource string
+
+var systemdServiceTemplate = template.Must(template.New("service").Parse(systemdServiceTemplateSource))
+var systemdTimerTemplate = template.Must(template.New("timer").Parse(systemdTimerTemplateSource))
+
+type systemdUnit struct {
+	Marker    string
+	ExecStart string
+	Schedule  string
+	Service   string
+}
+
+// isSystemdAction returns true if `name` is an action of the systemd command.
+func isSystemdAction(name string) bool {
+	for _, action := range systemdActions {
+		if action == name {
+			return true
+		}
+	}
+	return false
+}
+
+// systemdQuote quotes `argument` for a command line in a unit file.
+func systemdQuote(argument string) string {
+	argument = strings.ReplaceAll(argument, "%", "%%")
+	argument = strings.ReplaceAll(argument, "$", "$$")
+	if argument != "" && !strings.ContainsAny(argument, " \t\"'\\;") {
+		return argument
+	}
+	argument = strings.ReplaceAll(argument, `\`, `\\`)
+	argument = strings.ReplaceAll(argument, `"`, `\"`)
+	return `"` + argument + `"`
+}
+
+// systemdUnitFolder returns the folder of the user units.
+func systemdUnitFolder() (string, error) {
+	if configHome := os.Getenv("XDG_CONFIG_HOME"); configHome != "" {
+		return path.Join(configHome, "systemd", "user"), nil
+	}
+	// In a snap HOME points to the snap's own folder.
+	home, ok := os.LookupEnv("SNAP_REAL_HOME")
+	if !ok {
+		var err error
+		home, err = os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+	}
+	return path.Join(home, ".config", "systemd", "user"), nil
+}
+
+// systemdExecutable returns the path of pick-files to run from the units. In a
+// snap this is the wrapper in /snap/bin which, unlike the path of the running
+// executable, does not change with the revision.
+func systemdExecutable() (string, error) {
+	if name, ok := os.LookupEnv("SNAP_NAME"); ok {
+		return path.Join("/snap/bin", name), nil
+	}
+	return os.Executable()
+}
+
+// renderSystemdUnits returns the content of the service and timer units which
+// run `executable` with the configuration file `config` on `schedule`, given
+// as systemd OnCalendar expression.
+func renderSystemdUnits(executable, config, schedule string) (map[string]string, error) {
+	if strings.TrimSpace(schedule) == "" || strings.ContainsAny(schedule, "\n\r") {
+		return nil, fmt.Errorf("invalid schedule %q", schedule)
+	}
+	var unit systemdUnit = systemdUnit{
+		Marker:    systemdUnitMarker,
+		ExecStart: systemdQuote(executable) + " --config " + systemdQuote(config),
+		Schedule:  strings.TrimSpace(schedule),
+		Service:   systemdServiceName,
+	}
+	var result map[string]string = map[string]string{}
+	for name, unitTemplate := range map[string]*template.Template{
+		systemdServiceName: systemdServiceTemplate,
+		systemdTimerName:   systemdTimerTemplate,
+	} {
+		var content bytes.Buffer
+		err := unitTemplate.Execute(&content, unit)
+		if err != nil {
+			return nil, err
+		}
+		result[name] = content.String()
+	}
+	return result, nil
+}
+
+// checkGeneratedUnit returns an error if the unit file `filename` exists but
+// was not generated by pick-files. The returned bool is true if the file
+// exists.
+func checkGeneratedUnit(filename string) (bool, error) {
+	content, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !strings.HasPrefix(string(content), systemdUnitMarker) {
+		return true, fmt.Errorf("%s was not generated by pick-files, not touching it", filename)
+	}
+	return true, nil
+}
+
+// runSystemctl runs systemctl with `arguments`.
+func runSystemctl(arguments ...string) error {
+	var command []string = append(append([]string{}, systemctlCommand...), arguments...)
+	log.Debug().Msgf("running %s", strings.Join(command, " "))
+	var cmd *exec.Cmd = exec.Command(command[0], command[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// installSystemdUnits writes the service and timer units for picking files
+// with the configuration file of `options` on `options.schedule` and enables
+// the timer.
+func installSystemdUnits(options ProgramOptions) error {
+	if options.configurationFile == "" {
+		return errors.New("the units require a configuration file, use the --config option")
+	}
+	config, err := filepath.Abs(options.configurationFile)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(config); err != nil {
+		return fmt.Errorf("cannot use configuration file: %w", err)
+	}
+	executable, err := systemdExecutable()
+	if err != nil {
+		return err
+	}
+	units, err := renderSystemdUnits(executable, config, options.schedule)
+	if err != nil {
+		return err
+	}
+	folder, err := systemdUnitFolder()
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{systemdServiceName, systemdTimerName} {
+		if _, err := checkGeneratedUnit(path.Join(folder, name)); err != nil {
+			return err
+		}
+	}
+	err = os.MkdirAll(folder, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{systemdServiceName, systemdTimerName} {
+		log.Info().Msgf("writing %s", path.Join(folder, name))
+		err = os.WriteFile(path.Join(folder, name), []byte(units[name]), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	err = runSystemctl("daemon-reload")
+	if err != nil {
+		return err
+	}
+	return runSystemctl("enable", "--now", systemdTimerName)
+}
+
+// uninstallSystemdUnits disables the timer and removes the units written by
+// installSystemdUnits.
+func uninstallSystemdUnits() error {
+	folder, err := systemdUnitFolder()
+	if err != nil {
+		return err
+	}
+	var installed bool = false
+	for _, name := range []string{systemdServiceName, systemdTimerName} {
+		exists, err := checkGeneratedUnit(path.Join(folder, name))
+		if err != nil {
+			return err
+		}
+		installed = installed || exists
+	}
+	if !installed {
+		log.Info().Msgf("no units installed in %s", folder)
+		return nil
+	}
+	err = runSystemctl("disable", "--now", systemdTimerName)
+	if err != nil {
+		log.Warn().Msgf("could not disable %s: %s", systemdTimerName, err.Error())
+	}
+	for _, name := range []string{systemdServiceName, systemdTimerName} {
+		log.Info().Msgf("removing %s", path.Join(folder, name))
+		err = os.Remove(path.Join(folder, name))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return runSystemctl("daemon-reload")
+}
+
+// systemdStatus shows the status of the timer and the last run of the
+// service.
+func systemdStatus() error {
+	folder, err := systemdUnitFolder()
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{systemdServiceName, systemdTimerName} {
+		exists, err := checkGeneratedUnit(path.Join(folder, name))
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%s is not installed, use `pick-files systemd install`", name)
+		}
+	}
+	err = runSystemctl("list-timers", "--all", systemdTimerName)
+	if err != nil {
+		return err
+	}
+	err = runSystemctl("status", "--no-pager", systemdServiceName)
+	// systemctl status exits with 3 if the unit is not active, which is the
+	// normal state of the service between runs.
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) && exitError.ExitCode() == 3 {
+		return nil
+	}
+	return err
+}
+
+// runSystemdCommand runs `pick-files systemd ACTION`.
+func runSystemdCommand(options ProgramOptions) {
+	var err error
+	switch options.systemdAction {
+	case "install":
+		err = installSystemdUnits(options)
+	case "uninstall":
+		err = uninstallSystemdUnits()
+	case "status":
+		err = systemdStatus()
+	}
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestSystemdQuote(t *testing.T) {
+	for argument, expected := range map[string]string{
+		"/usr/bin/pick-files":       "/usr/bin/pick-files",
+		"/home/user/my config.yaml": `"/home/user/my config.yaml"`,
+		`/tmp/a"b`:                  `"/tmp/a\"b"`,
+		"/tmp/100%/$HOME":           "/tmp/100%%/$$HOME",
+		"":                          `""`,
+	} {
+		if systemdQuote(argument) != expected {
+			t.Errorf("expected %q to be quoted as %s but got %s", argument, expected, systemdQuote(argument))
+		}
+	}
+}
+
+func TestSystemdUnits(t *testing.T) {
+	var tempDir string = t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", path.Join(tempDir, "config"))
+	t.Setenv("SNAP_NAME", "pick-files")
+	var calls string = path.Join(tempDir, "calls")
+	var systemctl string = path.Join(tempDir, "systemctl")
+	if err := os.WriteFile(systemctl, []byte("#!/bin/sh\necho \"$@\" >> "+calls+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	var command []string = systemctlCommand
+	systemctlCommand = []string{systemctl, "--user"}
+	t.Cleanup(func() { systemctlCommand = command })
+
+	var config string = path.Join(tempDir, "pick files.yaml")
+	if err := os.WriteFile(config, []byte("number: 5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var options ProgramOptions = ProgramOptions{configurationFile: config, schedule: "Mon *-*-* 08:00"}
+	if err := installSystemdUnits(options); err != nil {
+		t.Fatal(err)
+	}
+	var folder string = path.Join(tempDir, "config", "systemd", "user")
+	service, err := os.ReadFile(path.Join(folder, systemdServiceName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(service), `ExecStart = /snap/bin/pick-files --config "`+config+`"`) {
+		t.Errorf("unexpected service unit:\n%s", service)
+	}
+	timer, err := os.ReadFile(path.Join(folder, systemdTimerName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(timer), "OnCalendar = Mon *-*-* 08:00\n") || !strings.Contains(string(timer), "Unit = "+systemdServiceName) {
+		t.Errorf("unexpected timer unit:\n%s", timer)
+	}
+
+	if err := systemdStatus(); err != nil {
+		t.Errorf("unexpected error getting status: %s", err.Error())
+	}
+	if err := uninstallSystemdUnits(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{systemdServiceName, systemdTimerName} {
+		if _, err := os.Stat(path.Join(folder, name)); err == nil {
+			t.Errorf("expected %s to be removed", name)
+		}
+	}
+	called, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected string = strings.Join([]string{
+		"--user daemon-reload",
+		"--user enable --now " + systemdTimerName,
+		"--user list-timers --all " + systemdTimerName,
+		"--user status --no-pager " + systemdServiceName,
+		"--user disable --now " + systemdTimerName,
+		"--user daemon-reload",
+	}, "\n") + "\n"
+	if string(called) != expected {
+		t.Errorf("expected systemctl calls\n%s\nbut got\n%s", expected, called)
+	}
+
+	// Units not written by pick-files are left alone.
+	if err := os.WriteFile(path.Join(folder, systemdTimerName), []byte("[Timer]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := installSystemdUnits(options); err == nil {
+		t.Errorf("expected error overwriting a foreign unit")
+	}
+	if err := uninstallSystemdUnits(); err == nil {
+		t.Errorf("expected error removing a foreign unit")
+	}
+}
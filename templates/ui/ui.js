@@ -0,0 +1,174 @@
+(function () {
+  "use strict";
+  var profileSelect = document.getElementById("profile");
+  var statusLine = document.getElementById("status");
+
+  function isImage(name) {
+    return /\.(jpe?g|png|gif)$/i.test(name);
+  }
+
+  function request(method, url, body) {
+    var options = {method: method, headers: {}};
+    if (body !== undefined) {
+      options.headers["Content-Type"] = "application/json";
+      options.body = JSON.stringify(body);
+    }
+    return fetch(url, options).then(function (response) {
+      return response.json().then(function (result) {
+        if (!response.ok) {
+          throw new Error(result.error || response.statusText);
+        }
+        return result;
+      });
+    });
+  }
+
+  function element(tag, className, text) {
+    var result = document.createElement(tag);
+    if (className) {
+      result.className = className;
+    }
+    if (text !== undefined) {
+      result.textContent = text;
+    }
+    return result;
+  }
+
+  function flagButton(file, flag, label) {
+    var button = element("button", "small" + (file[flag] ? " active" : ""), label);
+    button.type = "button";
+    button.addEventListener("click", function () {
+      var change = {};
+      change[flag] = !file[flag];
+      request("PATCH", "/api/files/" + file.md5sum, change).then(refresh, showError);
+    });
+    return button;
+  }
+
+  function fileCard(file) {
+    var figure = element("figure");
+    var link = element("a");
+    link.href = file.url;
+    link.target = "_blank";
+    if (isImage(file.name)) {
+      var img = element("img");
+      img.src = file.url + "/thumbnail";
+      img.alt = file.name;
+      img.loading = "lazy";
+      link.appendChild(img);
+    } else {
+      link.appendChild(element("div", "placeholder", file.name));
+    }
+    figure.appendChild(link);
+    var caption = element("figcaption", "", file.name);
+    caption.appendChild(element("br"));
+    caption.appendChild(element("span", "meta", "picked " + file.pickCount + " time(s) "));
+    caption.appendChild(flagButton(file, "favourite", "Favourite"));
+    caption.appendChild(document.createTextNode(" "));
+    caption.appendChild(flagButton(file, "banned", "Ban"));
+    figure.appendChild(caption);
+    return figure;
+  }
+
+  function fileItem(file) {
+    var item = element("li");
+    var link = element("a", "", file.name);
+    link.href = file.url;
+    link.target = "_blank";
+    item.appendChild(link);
+    item.appendChild(element("span", "meta", " " + file.pickCount + " pick(s) "));
+    item.appendChild(flagButton(file, "favourite", "Favourite"));
+    item.appendChild(document.createTextNode(" "));
+    item.appendChild(flagButton(file, "banned", "Ban"));
+    return item;
+  }
+
+  function fill(id, files, render) {
+    var container = document.getElementById(id);
+    container.replaceChildren.apply(container, files.map(render));
+    if (files.length === 0) {
+      container.appendChild(element("p", "meta", "none"));
+    }
+  }
+
+  function showError(error) {
+    statusLine.textContent = error.message;
+  }
+
+  function loadPicks() {
+    if (!profileSelect.value) {
+      fill("picks", [], fileCard);
+      return Promise.resolve();
+    }
+    return request("GET", "/api/profiles/" + encodeURIComponent(profileSelect.value) + "/picks").then(function (files) {
+      fill("picks", files, fileCard);
+    });
+  }
+
+  function loadHistory() {
+    return request("GET", "/api/history?limit=10").then(function (runs) {
+      fill("history", runs, function (run) {
+        var div = element("div", "run", new Date(run.time).toLocaleString() + ": " + run.files.length + " file(s)");
+        var thumbs = element("div", "thumbs");
+        run.files.forEach(function (file) {
+          var link = element("a");
+          link.href = file.url;
+          link.target = "_blank";
+          link.title = file.name;
+          if (isImage(file.name)) {
+            var img = element("img");
+            img.src = file.url + "/thumbnail";
+            img.alt = file.name;
+            img.loading = "lazy";
+            link.appendChild(img);
+          } else {
+            link.textContent = file.name;
+          }
+          thumbs.appendChild(link);
+        });
+        div.appendChild(thumbs);
+        return div;
+      });
+    });
+  }
+
+  function loadLists() {
+    return Promise.all([
+      request("GET", "/api/files?order=least-picked&limit=10").then(function (files) { fill("least-picked", files, fileItem); }),
+      request("GET", "/api/files?order=most-picked&limit=10").then(function (files) { fill("most-picked", files, fileItem); }),
+      request("GET", "/api/files?filter=favourite&limit=50").then(function (files) { fill("favourites", files, fileItem); }),
+      request("GET", "/api/files?filter=banned&limit=50").then(function (files) { fill("banned", files, fileItem); }),
+      request("GET", "/api/statistics").then(function (statistics) {
+        document.getElementById("statistics").textContent = statistics.entries + " file(s), " + statistics.size + " bytes";
+      })
+    ]);
+  }
+
+  function refresh() {
+    return Promise.all([loadPicks(), loadHistory(), loadLists()]).catch(showError);
+  }
+
+  document.getElementById("reroll").addEventListener("click", function () {
+    if (!profileSelect.value) {
+      return;
+    }
+    statusLine.textContent = "picking files...";
+    request("POST", "/api/profiles/" + encodeURIComponent(profileSelect.value) + "/picks", {}).then(function (picks) {
+      statusLine.textContent = "picked " + picks.length + " file(s)";
+      return refresh();
+    }, showError);
+  });
+
+  profileSelect.addEventListener("change", function () {
+    loadPicks().catch(showError);
+  });
+
+  request("GET", "/api/profiles").then(function (profiles) {
+    profiles.forEach(function (profile) {
+      var option = element("option", "", profile.name);
+      option.value = profile.name;
+      profileSelect.appendChild(option);
+    });
+    return refresh();
+  }).catch(showError);
+}());
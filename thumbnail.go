@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"path"
+	"strings"
+)
+
+// thumbnailSize is the maximum width and height of thumbnails in pixels.
+const thumbnailSize int = 320
+
+// isImage returns true if `filename` has the suffix of a supported image
+// format.
+func isImage(filename string) bool {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return true
+	}
+	return false
+}
+
+// loadImage decodes the image in file `filename`, which can also be a file in
+// an archive or a remote folder.
+func loadImage(filename string) (image.Image, error) {
+	file, _, err := openSourceFile(sourceOf(filename))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	return img, err
+}
+
+// scaleImage scales `img` down such that it fits into `maxSize` by `maxSize`
+// pixels while keeping its aspect ratio. Each pixel of the scaled image is the
+// average of the pixels of `img` it covers. Images that already fit are
+// returned unchanged.
+func scaleImage(img image.Image, maxSize int) image.Image {
+	var bounds image.Rectangle = img.Bounds()
+	var width, height int = bounds.Dx(), bounds.Dy()
+	if width <= maxSize && height <= maxSize {
+		return img
+	}
+	var scaledWidth, scaledHeight int = maxSize, maxSize
+	if width > height {
+		scaledHeight = max(1, height*maxSize/width)
+	} else {
+		scaledWidth = max(1, width*maxSize/height)
+	}
+
+	var scaled *image.RGBA = image.NewRGBA(image.Rect(0, 0, scaledWidth, scaledHeight))
+	for y := 0; y < scaledHeight; y++ {
+		var y0, y1 int = y * height / scaledHeight, max((y+1)*height/scaledHeight, y*height/scaledHeight+1)
+		for x := 0; x < scaledWidth; x++ {
+			var x0, x1 int = x * width / scaledWidth, max((x+1)*width/scaledWidth, x*width/scaledWidth+1)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+					r, g, b, a, n = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa), n+1
+				}
+			}
+			var offset int = scaled.PixOffset(x, y)
+			scaled.Pix[offset+0] = uint8(r / n >> 8)
+			scaled.Pix[offset+1] = uint8(g / n >> 8)
+			scaled.Pix[offset+2] = uint8(b / n >> 8)
+			scaled.Pix[offset+3] = uint8(a / n >> 8)
+		}
+	}
+	return scaled
+}
+
+// encodeJPEG encodes `img` as JPEG.
+func encodeJPEG(img image.Image) ([]byte, error) {
+	var result bytes.Buffer
+	err := jpeg.Encode(&result, img, &jpeg.Options{Quality: 80})
+	return result.Bytes(), err
+}
+
+// makeThumbnail returns a JPEG encoded version of the image in `filename`
+// scaled down to fit into `maxSize` by `maxSize` pixels.
+func makeThumbnail(filename string, maxSize int) ([]byte, error) {
+	img, err := loadImage(filename)
+	if err != nil {
+		return nil, err
+	}
+	return encodeJPEG(scaleImage(img, maxSize))
+}
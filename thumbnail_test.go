@@ -0,0 +1,27 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestScaleImage(t *testing.T) {
+	var img *image.RGBA = image.NewRGBA(image.Rect(0, 0, 800, 400))
+	for x := 0; x < 800; x++ {
+		for y := 0; y < 400; y++ {
+			img.Set(x, y, color.RGBA{R: 200, G: 100, B: 50, A: 255})
+		}
+	}
+	var scaled image.Image = scaleImage(img, thumbnailSize)
+	if scaled.Bounds().Dx() != 320 || scaled.Bounds().Dy() != 160 {
+		t.Errorf("expected 320x160 but got %dx%d", scaled.Bounds().Dx(), scaled.Bounds().Dy())
+	}
+	r, g, b, _ := scaled.At(100, 100).RGBA()
+	if r>>8 != 200 || g>>8 != 100 || b>>8 != 50 {
+		t.Errorf("expected color (200, 100, 50) but got (%d, %d, %d)", r>>8, g>>8, b>>8)
+	}
+	if scaleImage(scaled, thumbnailSize) != scaled {
+		t.Errorf("expected small image to be returned unchanged")
+	}
+}
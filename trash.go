@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// trashInfoDateFormat is the format of the DeletionDate key in .trashinfo
+// files.
+const trashInfoDateFormat string = "2006-01-02T15:04:05"
+
+// homeTrashDirectory returns the home trash folder as defined by the
+// freedesktop.org Trash specification.
+func homeTrashDirectory() (string, error) {
+	dataHome, ok := os.LookupEnv("XDG_DATA_HOME")
+	if !ok || dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dataHome = path.Join(home, ".local", "share")
+	}
+	return path.Join(dataHome, "Trash"), nil
+}
+
+// moveToTrash moves the file or folder `filename` into the trash following the
+// freedesktop.org Trash specification so that it can be restored later.
+// Files are moved into the home trash if possible and into the trash folder at
+// the top of their mount point otherwise.
+func moveToTrash(filename string, now time.Time) error {
+	absolutePath, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	homeTrash, err := homeTrashDirectory()
+	if err != nil {
+		return err
+	}
+	err = trashInto(homeTrash, absolutePath, absolutePath, now)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	log.Debug().Msgf("%s is on a different file system than %s", absolutePath, homeTrash)
+	topDirectory, err := mountTopDirectory(path.Dir(absolutePath))
+	if err != nil {
+		return err
+	}
+	relativePath, err := filepath.Rel(topDirectory, absolutePath)
+	if err != nil {
+		return err
+	}
+	return trashInto(path.Join(topDirectory, fmt.Sprintf(".Trash-%d", os.Getuid())), absolutePath, relativePath, now)
+}
+
+// trashInto moves `absolutePath` into the trash folder `trash` and writes the
+// matching .trashinfo file recording `originalPath`.
+func trashInto(trash, absolutePath, originalPath string, now time.Time) error {
+	var filesFolder string = path.Join(trash, "files")
+	var infoFolder string = path.Join(trash, "info")
+	for _, folder := range []string{filesFolder, infoFolder} {
+		err := os.MkdirAll(folder, 0700)
+		if err != nil {
+			return fmt.Errorf("cannot create trash folder %s: %w", folder, err)
+		}
+	}
+
+	var extension string = path.Ext(absolutePath)
+	var stem string = strings.TrimSuffix(path.Base(absolutePath), extension)
+	for counter := 1; ; counter++ {
+		var name string = path.Base(absolutePath)
+		if counter > 1 {
+			name = fmt.Sprintf("%s.%d%s", stem, counter, extension)
+		}
+		if _, err := os.Lstat(path.Join(filesFolder, name)); err == nil {
+			continue
+		}
+		var infoFilename string = path.Join(infoFolder, name+".trashinfo")
+		info, err := os.OpenFile(infoFilename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(info, "[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+			(&url.URL{Path: originalPath}).EscapedPath(), now.Format(trashInfoDateFormat))
+		if closeErr := info.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(absolutePath, path.Join(filesFolder, name))
+		}
+		if err != nil {
+			os.Remove(infoFilename)
+			return err
+		}
+		log.Debug().Msgf("moved %s to trash %s as %s", absolutePath, trash, name)
+		return nil
+	}
+}
+
+// mountTopDirectory returns the top directory of the mount point holding
+// `folder`.
+func mountTopDirectory(folder string) (string, error) {
+	info, err := os.Stat(folder)
+	if err != nil {
+		return "", err
+	}
+	device, ok := deviceID(info)
+	if !ok {
+		return "", fmt.Errorf("cannot determine mount point of %s", folder)
+	}
+	for folder != "/" {
+		parentInfo, err := os.Stat(path.Dir(folder))
+		if err != nil {
+			return "", err
+		}
+		parentDevice, _ := deviceID(parentInfo)
+		if parentDevice != device {
+			break
+		}
+		folder = path.Dir(folder)
+	}
+	return folder, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestMoveToTrash(t *testing.T) {
+	var tempDir string = t.TempDir()
+	t.Setenv("XDG_DATA_HOME", path.Join(tempDir, "data"))
+	var now time.Time = time.Date(2026, 10, 18, 11, 0, 0, 0, time.Local)
+
+	var filename string = path.Join(tempDir, "my photo.jpg")
+	for i := 0; i < 2; i++ {
+		if err := os.WriteFile(filename, []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := moveToTrash(filename, now); err != nil {
+			t.Fatalf("unexpected error %s", err.Error())
+		}
+	}
+
+	if _, err := os.Stat(filename); err == nil {
+		t.Errorf("expected %s to be removed", filename)
+	}
+	var trash string = path.Join(tempDir, "data", "Trash")
+	for _, name := range []string{"files/my photo.jpg", "files/my photo.2.jpg", "info/my photo.2.jpg.trashinfo"} {
+		if _, err := os.Stat(path.Join(trash, name)); err != nil {
+			t.Errorf("expected %s in trash", name)
+		}
+	}
+	info, err := os.ReadFile(path.Join(trash, "info", "my photo.jpg.trashinfo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expectedInfo string = "[Trash Info]\nPath=" + path.Join(tempDir, "my%20photo.jpg") + "\nDeletionDate=2026-10-18T11:00:00\n"
+	if string(info) != expectedInfo {
+		t.Errorf("expected %q but got %q", expectedInfo, string(info))
+	}
+}
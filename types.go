@@ -32,11 +32,16 @@ func (f *Suffixes) String() string {
 
 // File represents a regular file in the source folders.
 type File struct {
-	Name       string    `json:"name"`
-	Path       string    `json:"path"`
-	Md5sum     string    `json:"md5sum"`
-	LastPicked time.Time `json:"lastPicked"`
-	LastSeen   time.Time `json:"lastSeen"`
+	Name        string      `json:"name"`
+	Path        string      `json:"path"`
+	Md5sum      string      `json:"md5sum"`
+	LastPicked  time.Time   `json:"lastPicked"`
+	LastSeen    time.Time   `json:"lastSeen"`
+	Removed     bool        `json:"removed,omitempty"`
+	PickCount   int         `json:"pickCount,omitempty"`
+	PickHistory []time.Time `json:"pickHistory,omitempty"`
+	Banned      bool        `json:"banned,omitempty"`
+	Favourite   bool        `json:"favourite,omitempty"`
 }
 
 func (f File) String() string {
@@ -54,3 +59,62 @@ func (fs Files) String() string {
 	}
 	return strings.Join(intermediate, ", ")
 }
+
+// PreserveAttributes selects the attributes of a source file that are carried
+// over onto the copied destination file.
+type PreserveAttributes struct {
+	Mode   bool
+	Times  bool
+	Xattrs bool
+}
+
+// Set parses a comma separated list of attributes, e.g. 'mode,times,xattrs',
+// and adds those to the preserved attributes.
+func (p *PreserveAttributes) Set(s string) error {
+	for _, attribute := range strings.Split(s, ",") {
+		switch strings.TrimSpace(attribute) {
+		case "mode":
+			p.Mode = true
+		case "times":
+			p.Times = true
+		case "xattrs":
+			p.Xattrs = true
+		case "all":
+			p.Mode, p.Times, p.Xattrs = true, true, true
+		case "":
+		default:
+			return fmt.Errorf("unknown attribute %s", attribute)
+		}
+	}
+	return nil
+}
+
+func (p *PreserveAttributes) String() string {
+	var attributes []string = []string{}
+	if p.Mode {
+		attributes = append(attributes, "mode")
+	}
+	if p.Times {
+		attributes = append(attributes, "times")
+	}
+	if p.Xattrs {
+		attributes = append(attributes, "xattrs")
+	}
+	return strings.Join(attributes, ",")
+}
+
+func (p *PreserveAttributes) UnmarshalText(bs []byte) error {
+	return p.Set(string(bs))
+}
+
+func (p PreserveAttributes) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// Pick is a picked file and where it was placed.
+type Pick struct {
+	Source             string    `json:"source"`
+	Destination        string    `json:"destination,omitempty"`
+	Md5sum             string    `json:"md5sum"`
+	PreviousLastPicked time.Time `json:"previousLastPicked"`
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+// watchSettleTime is how long the watched folders have to be quiet before
+// changed files are hashed and the database is updated, so that files still
+// being written are not hashed repeatedly.
+var watchSettleTime time.Duration = 2 * time.Second
+
+// fileWatcher keeps the database records of the files in a set of folders
+// current by watching the folders for changes.
+type fileWatcher struct {
+	watcher *fsnotify.Watcher
+	folders []string
+	// changed holds the paths of files created or written since the last
+	// update.
+	changed map[string]bool
+	// removed holds the paths of files and folders removed since the last
+	// update.
+	removed map[string]bool
+}
+
+// isUnderFolder returns true if `filename` is in the folder `folder` or one of
+// its sub-folders.
+func isUnderFolder(filename, folder string) bool {
+	folder = path.Clean(folder)
+	return filename == folder || strings.HasPrefix(filename, strings.TrimSuffix(folder, "/")+"/")
+}
+
+// isUnderFolders returns true if `filename` is in any of the folders.
+func isUnderFolders(filename string, folders []string) bool {
+	for _, folder := range folders {
+		if isUnderFolder(filename, folder) {
+			return true
+		}
+	}
+	return false
+}
+
+// syncWatchedFiles updates `files` with the result `scanned` of a full scan
+// of `folders`: scanned files are merged in and records in the folders that
+// were not found are marked as removed.
+func syncWatchedFiles(files Files, folders []string, scanned Files) Files {
+	var present map[string]bool = map[string]bool{}
+	for _, file := range scanned {
+		present[file.Md5sum] = true
+	}
+	var result Files = mergeFiles(files, scanned)
+	for i, file := range result {
+		if !present[file.Md5sum] && isUnderFolders(file.Path, folders) && !file.Removed {
+			log.Debug().Msgf("%s no longer exists", file.Path)
+			result[i].Removed = true
+		}
+	}
+	return result
+}
+
+// markRemoved marks the records of `filename` and, if it is a folder, of all
+// files in it as removed.
+func markRemoved(files Files, filename string) Files {
+	for i, file := range files {
+		if isUnderFolder(file.Path, filename) && !file.Removed {
+			log.Debug().Msgf("marking %s as removed", file.Path)
+			files[i].Removed = true
+		}
+	}
+	return files
+}
+
+// upsertFile adds or updates the record of `file`. A record of different
+// content at the same path is marked as removed.
+func upsertFile(files Files, file File) Files {
+	for i := range files {
+		if files[i].Path == file.Path && files[i].Md5sum != file.Md5sum {
+			files[i].Removed = true
+		}
+	}
+	for i := range files {
+		if files[i].Md5sum == file.Md5sum {
+			files[i].Name = file.Name
+			files[i].Path = file.Path
+			files[i].LastSeen = file.LastSeen
+			files[i].Removed = false
+			return files
+		}
+	}
+	return append(files, file)
+}
+
+// newFileWatcher returns a fileWatcher watching `folders` and all their
+// sub-folders.
+func newFileWatcher(folders []string) (*fileWatcher, error) {
+	for _, folder := range folders {
+		if isRemotePath(folder) {
+			return nil, fmt.Errorf("cannot watch remote folder %s", folder)
+		}
+		if info, err := os.Stat(folder); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("cannot watch %s, not a folder", folder)
+		}
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	var result *fileWatcher = &fileWatcher{
+		watcher: watcher,
+		changed: map[string]bool{},
+		removed: map[string]bool{},
+	}
+	for _, folder := range folders {
+		result.folders = append(result.folders, path.Clean(folder))
+		err = result.addFolder(path.Clean(folder), false)
+		if err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// addFolder watches `folder` and its sub-folders. If `queue` is true then the
+// files in them are queued for hashing, e.g. for a folder moved into a watched
+// folder.
+func (w *fileWatcher) addFolder(folder string, queue bool) error {
+	return filepath.WalkDir(folder, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			log.Debug().Msgf("watching %s", name)
+			return w.watcher.Add(name)
+		}
+		if queue && entry.Type().IsRegular() {
+			w.changed[name] = true
+		}
+		return nil
+	})
+}
+
+// handleEvent records the change reported by `event`.
+func (w *fileWatcher) handleEvent(event fsnotify.Event) {
+	var name string = path.Clean(event.Name)
+	log.Debug().Msgf("watch event %s", event.String())
+	switch {
+	case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+		w.removed[name] = true
+		for changed := range w.changed {
+			if isUnderFolder(changed, name) {
+				delete(w.changed, changed)
+			}
+		}
+	case event.Has(fsnotify.Create), event.Has(fsnotify.Write):
+		info, err := os.Lstat(name)
+		if err != nil {
+			return
+		}
+		if info.IsDir() {
+			err = w.addFolder(name, true)
+			if err != nil {
+				log.Warn().Msgf("cannot watch %s: %s", name, err.Error())
+			}
+			return
+		}
+		if info.Mode().IsRegular() {
+			w.changed[name] = true
+		}
+	}
+}
+
+// flush hashes the changed files and applies all recorded changes with
+// `update`.
+func (w *fileWatcher) flush(update func(func(Files) Files)) {
+	if len(w.changed) == 0 && len(w.removed) == 0 {
+		return
+	}
+	var removed []string = []string{}
+	for name := range w.removed {
+		removed = append(removed, name)
+	}
+	var changed []string = []string{}
+	for name := range w.changed {
+		changed = append(changed, name)
+	}
+	sort.Strings(changed)
+	var newFiles Files = Files{}
+	for _, name := range changed {
+		file, err := newFileFromPath(name)
+		if err != nil {
+			log.Warn().Msg(err.Error())
+			continue
+		}
+		newFiles = append(newFiles, file)
+	}
+	log.Info().Msgf("updating database with %d changed and %d removed file(s)", len(newFiles), len(removed))
+	update(func(files Files) Files {
+		for _, name := range removed {
+			files = markRemoved(files, name)
+		}
+		for _, file := range newFiles {
+			files = upsertFile(files, file)
+		}
+		return files
+	})
+	w.changed = map[string]bool{}
+	w.removed = map[string]bool{}
+}
+
+// run scans the watched folders once, and then applies changes with `update`
+// as they happen until `done` is closed.
+func (w *fileWatcher) run(update func(func(Files) Files), done <-chan struct{}) error {
+	defer w.watcher.Close()
+	scanned, err := getFilesFromFolders(w.folders)
+	if err != nil {
+		return err
+	}
+	update(func(files Files) Files {
+		return syncWatchedFiles(files, w.folders, scanned)
+	})
+	log.Info().Msgf("watching %d file(s) in %s", len(scanned), strings.Join(w.folders, ", "))
+
+	var settle <-chan time.Time
+	for {
+		select {
+		case <-done:
+			w.flush(update)
+			return nil
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return errors.New("file watcher closed unexpectedly")
+			}
+			w.handleEvent(event)
+			settle = time.After(watchSettleTime)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return errors.New("file watcher closed unexpectedly")
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				log.Warn().Msg("missed file events, rescanning folders")
+				scanned, err = getFilesFromFolders(w.folders)
+				if err != nil {
+					return err
+				}
+				update(func(files Files) Files {
+					return syncWatchedFiles(files, w.folders, scanned)
+				})
+				continue
+			}
+			log.Warn().Msgf("file watcher error: %s", err.Error())
+		case <-settle:
+			w.flush(update)
+		}
+	}
+}
+
+// watchFolders runs `pick-files watch`: it keeps the database current with
+// the files in the folders of `options` until it is interrupted.
+func watchFolders(options ProgramOptions) {
+	watcher, err := newFileWatcher(options.Folders)
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+	var done chan struct{} = make(chan struct{})
+	var signals chan os.Signal = make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Info().Msg("stopping file watcher")
+		close(done)
+	}()
+	err = watcher.run(updateDB, done)
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+}
+
+// watchedFiles returns the records of the files in `folders` kept current by
+// `pick-files watch`, for picking without scanning the folders. The files
+// are marked as seen now.
+func watchedFiles(allFiles Files, folders []string) Files {
+	var files Files = Files{}
+	var now time.Time = time.Now().UTC()
+	for _, file := range allFiles {
+		if file.Removed || !isUnderFolders(file.Path, folders) {
+			continue
+		}
+		file.LastSeen = now
+		files = append(files, file)
+	}
+	log.Debug().Msgf("found %d watched files in folder(s) %s", len(files), strings.Join(folders, ","))
+	return files
+}
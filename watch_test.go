@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileWatcher(t *testing.T) {
+	var settleTime time.Duration = watchSettleTime
+	watchSettleTime = 10 * time.Millisecond
+	t.Cleanup(func() { watchSettleTime = settleTime })
+	var folder string = t.TempDir()
+	if err := os.WriteFile(path.Join(folder, "a.jpg"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var lock sync.Mutex
+	var files Files = Files{
+		{Name: "gone.jpg", Path: path.Join(folder, "gone.jpg"), Md5sum: "gone", LastSeen: time.Now()},
+		{Name: "other.jpg", Path: "/elsewhere/other.jpg", Md5sum: "other", LastSeen: time.Now()},
+	}
+	update := func(change func(Files) Files) {
+		lock.Lock()
+		defer lock.Unlock()
+		files = change(files)
+	}
+	// waitFor waits until `check` returns true for the records.
+	waitFor := func(description string, check func(map[string]File) bool) {
+		t.Helper()
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+			lock.Lock()
+			var records map[string]File = map[string]File{}
+			for _, file := range files {
+				records[file.Path] = file
+			}
+			ok := check(records)
+			lock.Unlock()
+			if ok {
+				return
+			}
+		}
+		t.Fatalf("timed out waiting for %s: %s", description, files)
+	}
+
+	watcher, err := newFileWatcher([]string{folder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var done chan struct{} = make(chan struct{})
+	var stopped chan error = make(chan error)
+	go func() {
+		stopped <- watcher.run(update, done)
+	}()
+
+	waitFor("initial scan", func(records map[string]File) bool {
+		return records[path.Join(folder, "a.jpg")].Md5sum == "0cc175b9c0f1b6a831c399e269772661" &&
+			records[path.Join(folder, "gone.jpg")].Removed && !records["/elsewhere/other.jpg"].Removed
+	})
+
+	if err := os.Mkdir(path.Join(folder, "sub"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	// Give the watcher a moment to add the new folder.
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(path.Join(folder, "sub", "b.jpg"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("new file", func(records map[string]File) bool {
+		return records[path.Join(folder, "sub", "b.jpg")].Md5sum == "92eb5ffee6ae2fec3ad71c777531578f"
+	})
+
+	if err := os.WriteFile(path.Join(folder, "a.jpg"), []byte("c"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("changed file", func(records map[string]File) bool {
+		return records[path.Join(folder, "a.jpg")].Md5sum == "4a8a08f09d37b73795649038408b5f33"
+	})
+
+	if err := os.RemoveAll(path.Join(folder, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("removed file", func(records map[string]File) bool {
+		return records[path.Join(folder, "sub", "b.jpg")].Removed
+	})
+
+	close(done)
+	if err := <-stopped; err != nil {
+		t.Errorf("unexpected error from watcher: %s", err.Error())
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	var watched Files = watchedFiles(files, []string{folder})
+	if len(watched) != 1 || watched[0].Path != path.Join(folder, "a.jpg") {
+		t.Errorf("expected only %s to be watched but got %s", path.Join(folder, "a.jpg"), watched)
+	}
+	var removedCount int = 0
+	for _, file := range files {
+		if file.Removed {
+			removedCount++
+		}
+	}
+	// gone.jpg, sub/b.jpg, and the previous content of a.jpg.
+	if removedCount != 3 {
+		t.Errorf("expected 3 removed records but got %d: %s", removedCount, files)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// webdavPasswordVariable is the environment variable holding the WebDAV
+// password if the URL does not include one.
+const webdavPasswordVariable string = "PICK_FILES_WEBDAV_PASSWORD"
+
+// webdavPropfind requests the properties needed to list a collection.
+const webdavPropfind string = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:">
+  <d:prop>
+    <d:resourcetype/>
+    <d:getcontentlength/>
+    <d:getlastmodified/>
+  </d:prop>
+</d:propfind>`
+
+// webdavFolder is a collection on a WebDAV server given by a URL of the form
+// `dav://user@host/path`, or `davs://` for https.
+type webdavFolder struct {
+	client   *http.Client
+	root     *url.URL
+	display  *url.URL
+	username string
+	password string
+}
+
+// newWebDAVFolder returns the WebDAV collection at the `dav://` or `davs://`
+// URL `u`. The password is taken from the URL or the environment variable
+// PICK_FILES_WEBDAV_PASSWORD.
+func newWebDAVFolder(u *url.URL) *webdavFolder {
+	var root url.URL = *u
+	root.Scheme = "http"
+	if u.Scheme == "davs" {
+		root.Scheme = "https"
+	}
+	root.User = nil
+	var folder *webdavFolder = &webdavFolder{
+		client:  remoteHTTPClient,
+		root:    &root,
+		display: redactedURL(u),
+	}
+	if u.User != nil {
+		folder.username = u.User.Username()
+		folder.password, _ = u.User.Password()
+		if folder.password == "" {
+			folder.password = os.Getenv(webdavPasswordVariable)
+		}
+	}
+	return folder
+}
+
+// url returns the http URL of `name` in the collection.
+func (f *webdavFolder) url(name string) string {
+	var result url.URL = *f.root
+	result.Path = path.Join(f.root.Path, name)
+	result.RawPath = ""
+	return result.String()
+}
+
+func (f *webdavFolder) Path(name string) string {
+	var result url.URL = *f.display
+	result.Path = path.Join(f.display.Path, name)
+	result.RawPath = ""
+	return result.String()
+}
+
+// request sends a request with method `method` for `name` and returns the
+// response if its status is one of `expected`. A 404 response is reported as
+// fs.ErrNotExist.
+func (f *webdavFolder) request(method, name string, body io.Reader, size int64, header http.Header, expected ...int) (*http.Response, error) {
+	request, err := http.NewRequest(method, f.url(name), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		request.ContentLength = size
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	if f.username != "" {
+		request.SetBasicAuth(f.username, f.password)
+	}
+	response, err := f.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range expected {
+		if response.StatusCode == status {
+			return response, nil
+		}
+	}
+	response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil, &fs.PathError{Op: strings.ToLower(method), Path: f.Path(name), Err: fs.ErrNotExist}
+	}
+	return nil, fmt.Errorf("%s %s failed: %s", method, f.Path(name), response.Status)
+}
+
+type webdavMultistatus struct {
+	Responses []webdavResponse `xml:"DAV: response"`
+}
+
+type webdavResponse struct {
+	Href      string           `xml:"DAV: href"`
+	Propstats []webdavPropstat `xml:"DAV: propstat"`
+}
+
+type webdavPropstat struct {
+	Status string     `xml:"DAV: status"`
+	Prop   webdavProp `xml:"DAV: prop"`
+}
+
+type webdavProp struct {
+	ResourceType struct {
+		Collection *struct{} `xml:"DAV: collection"`
+	} `xml:"DAV: resourcetype"`
+	ContentLength string `xml:"DAV: getcontentlength"`
+	LastModified  string `xml:"DAV: getlastmodified"`
+}
+
+// propfind returns the properties of `name` and, with `depth` 1, of its
+// members keyed by their path on the server.
+func (f *webdavFolder) propfind(name string, depth int) (map[string]*remoteFileInfo, error) {
+	response, err := f.request("PROPFIND", name, strings.NewReader(webdavPropfind), int64(len(webdavPropfind)),
+		http.Header{
+			"Depth":        []string{strconv.Itoa(depth)},
+			"Content-Type": []string{"application/xml; charset=utf-8"},
+		}, http.StatusMultiStatus)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	var multistatus webdavMultistatus
+	err = xml.NewDecoder(response.Body).Decode(&multistatus)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse PROPFIND response for %s: %s", f.Path(name), err.Error())
+	}
+	var result map[string]*remoteFileInfo = map[string]*remoteFileInfo{}
+	for _, entry := range multistatus.Responses {
+		href, err := url.Parse(entry.Href)
+		if err != nil {
+			return nil, fmt.Errorf("invalid href %s in PROPFIND response: %s", entry.Href, err.Error())
+		}
+		var hrefPath string = strings.TrimSuffix(href.Path, "/")
+		for _, propstat := range entry.Propstats {
+			if !strings.Contains(propstat.Status, " 200 ") {
+				continue
+			}
+			var info *remoteFileInfo = &remoteFileInfo{
+				name: path.Base(hrefPath),
+				dir:  propstat.Prop.ResourceType.Collection != nil,
+			}
+			info.size, _ = strconv.ParseInt(propstat.Prop.ContentLength, 10, 64)
+			info.modTime, _ = http.ParseTime(propstat.Prop.LastModified)
+			result[hrefPath] = info
+		}
+	}
+	return result, nil
+}
+
+// serverPath returns the path of `name` on the server.
+func (f *webdavFolder) serverPath(name string) string {
+	return strings.TrimSuffix(path.Join(f.root.Path, name), "/")
+}
+
+func (f *webdavFolder) Stat(name string) (fs.FileInfo, error) {
+	infos, err := f.propfind(name, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		return info, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: f.Path(name), Err: fs.ErrNotExist}
+}
+
+func (f *webdavFolder) ReadDir(name string) ([]fs.DirEntry, error) {
+	infos, err := f.propfind(name, 1)
+	if err != nil {
+		return nil, err
+	}
+	var entries []fs.DirEntry = []fs.DirEntry{}
+	for hrefPath, info := range infos {
+		if hrefPath == f.serverPath(name) {
+			continue
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+func (f *webdavFolder) Open(name string) (fs.File, error) {
+	response, err := f.request(http.MethodGet, name, nil, 0, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	var info *remoteFileInfo = &remoteFileInfo{
+		name: path.Base(name),
+		size: response.ContentLength,
+	}
+	info.modTime, _ = http.ParseTime(response.Header.Get("Last-Modified"))
+	return &remoteFile{ReadCloser: response.Body, info: info}, nil
+}
+
+func (f *webdavFolder) MkdirAll(name string) error {
+	if info, err := f.Stat(name); err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a folder", f.Path(name))
+		}
+		return nil
+	}
+	if path.Join("/", f.root.Path, name) == "/" {
+		return fmt.Errorf("cannot create %s", f.Path(name))
+	}
+	err := f.MkdirAll(path.Join(name, ".."))
+	if err != nil {
+		return err
+	}
+	response, err := f.request("MKCOL", name, nil, 0, nil, http.StatusCreated, http.StatusMethodNotAllowed)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+func (f *webdavFolder) WriteFile(name string, content io.Reader, size int64) error {
+	response, err := f.request(http.MethodPut, name, content, size, nil,
+		http.StatusOK, http.StatusCreated, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+func (f *webdavFolder) Remove(name string) error {
+	response, err := f.request(http.MethodDelete, name, nil, 0, nil, http.StatusOK, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
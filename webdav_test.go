@@ -0,0 +1,167 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+// newWebDAVServer starts a WebDAV server serving `folder` under the prefix
+// /dav that requires the user `user` with password `secret`.
+func newWebDAVServer(t *testing.T, folder string) *httptest.Server {
+	var handler *webdav.Handler = &webdav.Handler{
+		Prefix:     "/dav",
+		FileSystem: webdav.Dir(folder),
+		LockSystem: webdav.NewMemLS(),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWebDAV(t *testing.T) {
+	var serverFolder string = t.TempDir()
+	for _, name := range []string{"photos/a.jpg", "photos/2020/b c.jpg"} {
+		if err := os.MkdirAll(path.Join(serverFolder, path.Dir(name)), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path.Join(serverFolder, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := newWebDAVServer(t, serverFolder)
+	t.Setenv(webdavPasswordVariable, "secret")
+	var base string = "dav://user@" + strings.TrimPrefix(server.URL, "http://") + "/dav"
+
+	files, err := getFilesFromFolders([]string{base + "/photos"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string = []string{}
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	var expectedPaths []string = []string{base + "/photos/2020/b%20c.jpg", base + "/photos/a.jpg"}
+	if strings.Join(paths, ",") != strings.Join(expectedPaths, ",") {
+		t.Fatalf("expected %s but got %s", strings.Join(expectedPaths, ","), strings.Join(paths, ","))
+	}
+	md5sum, err := md5sumFile(path.Join(serverFolder, "photos/a.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files[1].Md5sum != md5sum {
+		t.Errorf("expected md5 sum %s for %s but got %s", md5sum, files[1].Path, files[1].Md5sum)
+	}
+
+	var localCopy string = path.Join(t.TempDir(), "b c.jpg")
+	if _, err := copyFile(files[0].Path, localCopy, PreserveAttributes{Times: true}); err != nil {
+		t.Fatalf("unexpected error copying %s: %s", files[0].Path, err.Error())
+	}
+	if content, _ := os.ReadFile(localCopy); string(content) != "photos/2020/b c.jpg" {
+		t.Errorf("unexpected content %q of %s", content, localCopy)
+	}
+
+	var options ProgramOptions = ProgramOptions{
+		Destination:       base + "/output/picks",
+		DestinationOption: APPEND,
+		Verify:            true,
+	}
+	for i := 0; i < 2; i++ {
+		placed, err := placePickedFiles(options, files)
+		if err != nil {
+			t.Fatalf("unexpected error copying to %s: %s", options.Destination, err.Error())
+		}
+		if i == 0 && placed[files[1].Path] != options.Destination+"/a.jpg" {
+			t.Errorf("expected %s to be copied to %s/a.jpg but got %s", files[1].Path, options.Destination, placed[files[1].Path])
+		}
+	}
+	var expectedNames string = manifestFilename + ",a-1.jpg,a.jpg,b c-1.jpg,b c.jpg"
+	if names := readFolder(t, path.Join(serverFolder, "output/picks")); names != expectedNames {
+		t.Errorf("expected %s but got %s", expectedNames, names)
+	}
+
+	if err := os.WriteFile(path.Join(serverFolder, "output/picks/foreign.jpg"), []byte("foreign"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	options.DestinationOption = DELETE
+	if _, err := placePickedFiles(options, files[1:]); err != nil {
+		t.Fatalf("unexpected error copying to %s: %s", options.Destination, err.Error())
+	}
+	expectedNames = manifestFilename + ",a.jpg,foreign.jpg"
+	if names := readFolder(t, path.Join(serverFolder, "output/picks")); names != expectedNames {
+		t.Errorf("expected %s but got %s", expectedNames, names)
+	}
+
+	options.DestinationOption = PANIC
+	if _, err := placePickedFiles(options, files); err == nil {
+		t.Errorf("expected error copying to existing %s", options.Destination)
+	}
+	options.DestinationOption = ROTATE
+	if _, err := placePickedFiles(options, files); err == nil {
+		t.Errorf("expected error for unsupported destination option")
+	}
+
+	t.Setenv(webdavPasswordVariable, "wrong")
+	u, _ := url.Parse(base)
+	if _, err := newRemoteFolder(u).Stat("photos"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected authentication error but got %v", err)
+	}
+}
+
+// readFolder returns the sorted names of the entries in `folder`.
+func readFolder(t *testing.T, folder string) string {
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string = []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func TestWebDAVTimeout(t *testing.T) {
+	var timeout time.Duration = remoteIOTimeout
+	remoteIOTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { remoteIOTimeout = timeout })
+
+	var stalled chan struct{} = make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMultiStatus)
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><D:multistatus xmlns:D="DAV:">`))
+		w.(http.Flusher).Flush()
+		<-stalled
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(stalled) })
+
+	var result chan error = make(chan error, 1)
+	go func() {
+		_, err := getFilesFromFolders([]string{"dav://" + strings.TrimPrefix(server.URL, "http://") + "/dav"})
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Errorf("expected error from a stalled server")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected a stalled server to time out")
+	}
+}